@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const analyticsDir = "Analytics"
+
+// Length-of-stay buckets, by number of nights billed per room
+var stayBuckets = []struct {
+	label    string
+	min, max int
+}{
+	{"1 night", 1, 1},
+	{"2 nights", 2, 2},
+	{"3 nights", 3, 3},
+	{"4-6 nights", 4, 6},
+	{"7-13 nights", 7, 13},
+	{"14+ nights", 14, 1 << 30},
+}
+
+// roomStats are the key figures for a set of nights. Revenue is room
+// revenue before GST.
+type roomStats struct {
+	Label           string
+	RoomNights      int
+	AvailableNights int
+	Revenue         float64
+}
+
+func (s roomStats) occupancy() float64 {
+	if s.AvailableNights == 0 {
+		return 0
+	}
+	return float64(s.RoomNights) * 100 / float64(s.AvailableNights)
+}
+
+// adr is the average daily rate: revenue per room night sold
+func (s roomStats) adr() float64 {
+	if s.RoomNights == 0 {
+		return 0
+	}
+	return round2(s.Revenue / float64(s.RoomNights))
+}
+
+// revPAR is the revenue per available room night
+func (s roomStats) revPAR() float64 {
+	if s.AvailableNights == 0 {
+		return 0
+	}
+	return round2(s.Revenue / float64(s.AvailableNights))
+}
+
+type stayCount struct {
+	Label string
+	Stays int
+}
+
+type roomAnalytics struct {
+	From, To time.Time
+	Total    roomStats
+	Months   []roomStats
+	RoomMix  []roomStats
+	Stays    []stayCount
+}
+
+// buildRoomAnalytics counts every night of every room stay that falls
+// between from and to, both inclusive. Stays are counted in the length of
+// stay distribution when they start in the period.
+func buildRoomAnalytics(bills []Bill, from, to time.Time, inventory map[string]int) roomAnalytics {
+	from, to = dateOnly(from), dateOnly(to)
+	a := roomAnalytics{From: from, To: to, Total: roomStats{Label: "Total"}}
+
+	rooms := 0
+	for _, n := range inventory {
+		rooms += n
+	}
+
+	days := 0
+	monthIndex := map[string]int{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		key := d.Format("Jan 2006")
+		i, ok := monthIndex[key]
+		if !ok {
+			i = len(a.Months)
+			monthIndex[key] = i
+			a.Months = append(a.Months, roomStats{Label: key})
+		}
+		a.Months[i].AvailableNights += rooms
+		a.Total.AvailableNights += rooms
+		days++
+	}
+
+	mix := map[string]*roomStats{}
+	seen := map[string]bool{}
+	for roomType := range inventory {
+		seen[roomType] = true
+	}
+	stays := make([]int, len(stayBuckets))
+
+	for _, bill := range activeBills(bills) {
+		for _, item := range bill.Items {
+			start, end := dateOnly(item.FromDate), dateOnly(item.ToDate)
+			if !start.Before(from) && !start.After(to) {
+				for i, b := range stayBuckets {
+					if item.Days >= b.min && item.Days <= b.max {
+						stays[i]++
+					}
+				}
+			}
+
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+				m := &a.Months[monthIndex[d.Format("Jan 2006")]]
+				m.RoomNights++
+				m.Revenue += item.Rate
+				a.Total.RoomNights++
+				a.Total.Revenue += item.Rate
+
+				s := mix[item.Description]
+				if s == nil {
+					s = &roomStats{Label: item.Description}
+					mix[item.Description] = s
+				}
+				s.RoomNights++
+				s.Revenue += item.Rate
+				seen[item.Description] = true
+			}
+		}
+	}
+
+	a.Total.Revenue = round2(a.Total.Revenue)
+	for i := range a.Months {
+		a.Months[i].Revenue = round2(a.Months[i].Revenue)
+	}
+	for _, roomType := range orderedRoomTypes(seen) {
+		s := roomStats{Label: roomType}
+		if m := mix[roomType]; m != nil {
+			s = *m
+		}
+		s.Revenue = round2(s.Revenue)
+		s.AvailableNights = inventory[roomType] * days
+		a.RoomMix = append(a.RoomMix, s)
+	}
+	for i, b := range stayBuckets {
+		a.Stays = append(a.Stays, stayCount{Label: b.label, Stays: stays[i]})
+	}
+	return a
+}
+
+// share is the part of all room nights sold that went to one room type
+func (a roomAnalytics) share(s roomStats) float64 {
+	if a.Total.RoomNights == 0 {
+		return 0
+	}
+	return float64(s.RoomNights) * 100 / float64(a.Total.RoomNights)
+}
+
+// writeAnalyticsCSV writes one row per figure: section, label, metric, value
+func writeAnalyticsCSV(a roomAnalytics, path string) error {
+	var rows [][]string
+	stats := func(section string, s roomStats) {
+		rows = append(rows,
+			[]string{section, s.Label, "room_nights", strconv.Itoa(s.RoomNights)},
+			[]string{section, s.Label, "available_room_nights", strconv.Itoa(s.AvailableNights)},
+			[]string{section, s.Label, "revenue", money(s.Revenue)},
+			[]string{section, s.Label, "occupancy_pct", fmt.Sprintf("%.1f", s.occupancy())},
+			[]string{section, s.Label, "adr", money(s.adr())},
+			[]string{section, s.Label, "revpar", money(s.revPAR())},
+		)
+	}
+
+	rows = append(rows,
+		[]string{"period", "from", "date", a.From.Format("2006-01-02")},
+		[]string{"period", "to", "date", a.To.Format("2006-01-02")},
+	)
+	stats("total", a.Total)
+	for _, m := range a.Months {
+		stats("month", m)
+	}
+	for _, s := range a.RoomMix {
+		stats("room_type", s)
+		rows = append(rows, []string{"room_type", s.Label, "share_pct", fmt.Sprintf("%.1f", a.share(s))})
+	}
+	for _, s := range a.Stays {
+		rows = append(rows, []string{"length_of_stay", s.Label, "stays", strconv.Itoa(s.Stays)})
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeCSV(path, []string{"section", "label", "metric", "value"}, rows)
+}
+
+// barChart draws a horizontal bar per value, scaled to the largest one
+func barChart(title string, labels []string, values []float64, format func(float64) string) fyne.CanvasObject {
+	const maxWidth = 260
+
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	rows := container.NewVBox(widget.NewLabelWithStyle(title, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+	for i, v := range values {
+		width := float32(0)
+		if max > 0 {
+			width = float32(v / max * maxWidth)
+		}
+		bar := canvas.NewRectangle(theme.PrimaryColor())
+		bar.SetMinSize(fyne.NewSize(width, 18))
+		spacer := canvas.NewRectangle(color.Transparent)
+		spacer.SetMinSize(fyne.NewSize(maxWidth-width, 18))
+
+		label := widget.NewLabel(labels[i])
+		rows.Add(container.NewBorder(nil, nil, label, widget.NewLabel(format(v)),
+			container.NewHBox(bar, spacer)))
+	}
+	return rows
+}
+
+func analyticsCharts(a roomAnalytics) fyne.CanvasObject {
+	percent := func(v float64) string { return fmt.Sprintf("%.1f%%", v) }
+	count := func(v float64) string { return fmt.Sprintf("%.0f", v) }
+
+	var monthLabels []string
+	var occupancy, adr []float64
+	for _, m := range a.Months {
+		monthLabels = append(monthLabels, m.Label)
+		occupancy = append(occupancy, m.occupancy())
+		adr = append(adr, m.adr())
+	}
+
+	var mixLabels []string
+	var mix []float64
+	for _, s := range a.RoomMix {
+		mixLabels = append(mixLabels, s.Label)
+		mix = append(mix, a.share(s))
+	}
+
+	var stayLabels []string
+	var stays []float64
+	for _, s := range a.Stays {
+		stayLabels = append(stayLabels, s.Label)
+		stays = append(stays, float64(s.Stays))
+	}
+
+	summary := widget.NewLabel(fmt.Sprintf(
+		"Room nights sold: %d of %d\nOccupancy: %.1f%%\nADR: %s\nRevPAR: %s\nRoom revenue: %s",
+		a.Total.RoomNights, a.Total.AvailableNights, a.Total.occupancy(),
+		money(a.Total.adr()), money(a.Total.revPAR()), money(a.Total.Revenue)))
+	if a.Total.AvailableNights == 0 {
+		summary.SetText(summary.Text + "\n\nSet the number of rooms in Settings to see occupancy and RevPAR.")
+	}
+
+	return container.NewVBox(
+		summary,
+		barChart("Occupancy by Month", monthLabels, occupancy, percent),
+		barChart("ADR by Month", monthLabels, adr, money),
+		barChart("Room Type Mix (share of room nights)", mixLabels, mix, percent),
+		barChart("Length of Stay (room stays)", stayLabels, stays, count),
+	)
+}
+
+func showAnalyticsWindow(myApp fyne.App, billDB *BillDB) {
+	window := myApp.NewWindow("Occupancy Analytics")
+
+	now := time.Now()
+	fromDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	toDate := now
+
+	fromDatePicker := widget.NewEntry()
+	fromDatePicker.SetText(fromDate.Format("02-01-2006"))
+	fromDatePicker.Disable()
+
+	toDatePicker := widget.NewEntry()
+	toDatePicker.SetText(toDate.Format("02-01-2006"))
+	toDatePicker.Disable()
+
+	fromDateButton := widget.NewButton("Select From Date", func() {
+		showDatePicker(window, &fromDate, fromDatePicker)
+	})
+
+	toDateButton := widget.NewButton("Select To Date", func() {
+		showDatePicker(window, &toDate, toDatePicker)
+	})
+
+	charts := container.NewVBox()
+	statusLabel := widget.NewLabel("")
+	var current *roomAnalytics
+
+	showButton := widget.NewButton("Show", func() {
+		if dateOnly(toDate).Before(dateOnly(fromDate)) {
+			statusLabel.SetText("To date must be after from date")
+			return
+		}
+		a := buildRoomAnalytics(billDB.getBills(), fromDate, toDate, loadSettings().RoomInventory)
+		current = &a
+		charts.Objects = []fyne.CanvasObject{analyticsCharts(a)}
+		charts.Refresh()
+		statusLabel.SetText("")
+	})
+
+	exportButton := widget.NewButton("Export CSV", func() {
+		if current == nil {
+			statusLabel.SetText("Please show the analytics first")
+			return
+		}
+		path := filepath.Join(analyticsDir, fmt.Sprintf("analytics_%s_%s.csv",
+			current.From.Format("2006-01-02"), current.To.Format("2006-01-02")))
+		if err := writeAnalyticsCSV(*current, path); err != nil {
+			statusLabel.SetText("Error exporting CSV: " + err.Error())
+			return
+		}
+		statusLabel.SetText("Analytics exported to " + path)
+	})
+
+	controls := container.NewVBox(
+		widget.NewLabel("Period:"),
+		container.NewGridWithColumns(2, fromDatePicker, toDatePicker),
+		container.NewGridWithColumns(2, fromDateButton, toDateButton),
+		container.NewGridWithColumns(2, showButton, exportButton),
+		statusLabel,
+	)
+
+	window.SetContent(container.NewBorder(controls, nil, nil, nil, container.NewVScroll(charts)))
+	window.Resize(fyne.NewSize(600, 700))
+	window.Show()
+}
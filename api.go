@@ -0,0 +1,411 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// openAPISpec describes the endpoints served by the serve command
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+const (
+	minAPITokenLength = 16
+	maxAPIRequestSize = 1 << 20
+)
+
+// apiServer serves the JSON API used by the booking website and the
+// reception tablet. Data is reloaded from disk on every request so that
+// customers and bills added from the desktop app are picked up, and every
+// change takes the data lock so that the two never overwrite each other.
+type apiServer struct {
+	token string
+	mu    sync.Mutex
+}
+
+type apiCustomerRequest struct {
+	batchCustomer
+	CompanyID string `json:"company_id"`
+}
+
+type apiAmounts struct {
+	Taxable float64 `json:"taxable"`
+	IGST    float64 `json:"igst"`
+	CGST    float64 `json:"cgst"`
+	SGST    float64 `json:"sgst"`
+	Total   float64 `json:"total"`
+	Paid    float64 `json:"paid"`
+	Balance float64 `json:"balance"`
+}
+
+// apiDuplicateMatch names a possible returning guest without any of their
+// details, which the caller may not be entitled to see
+type apiDuplicateMatch struct {
+	ID      string   `json:"id"`
+	Reasons []string `json:"reasons"`
+}
+
+// apiCustomer is a customer as the API shows it. The API runs as front
+// desk, so the ID number is masked and the ID photo, Form C details and
+// staff notes are left out.
+type apiCustomer struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Address     string    `json:"address"`
+	Phone       string    `json:"phone"`
+	Nationality string    `json:"nationality"`
+	GovIDType   string    `json:"gov_id_type"`
+	GovIDNumber string    `json:"gov_id_number"`
+	CompanyID   string    `json:"company_id,omitempty"`
+	AddedOn     time.Time `json:"added_on"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+}
+
+// apiGuest is another occupant of a stay as the API shows it
+type apiGuest struct {
+	Name        string `json:"name"`
+	AgeBand     string `json:"age_band"`
+	Relation    string `json:"relation"`
+	Nationality string `json:"nationality"`
+	GovIDType   string `json:"gov_id_type,omitempty"`
+	GovIDNumber string `json:"gov_id_number,omitempty"`
+}
+
+// apiBill replaces the customer and guests of the stored bill with their
+// API views
+type apiBill struct {
+	Bill
+	Customer apiCustomer `json:"customer"`
+	Guests   []apiGuest  `json:"guests,omitempty"`
+	Amounts  apiAmounts  `json:"amounts"`
+	PDF      string      `json:"pdf"`
+}
+
+func newAPICustomer(s Settings, c Customer) apiCustomer {
+	return apiCustomer{
+		ID:          c.ID,
+		Name:        c.Name,
+		Address:     c.Address,
+		Phone:       c.Phone,
+		Nationality: c.nationality(),
+		GovIDType:   c.GovIDType,
+		GovIDNumber: s.maskGovID(c.GovIDType, c.GovIDNumber),
+		CompanyID:   c.CompanyID,
+		AddedOn:     c.AddedOn,
+		CreatedBy:   c.CreatedBy,
+	}
+}
+
+func newAPIGuests(s Settings, guests []StayGuest) []apiGuest {
+	var out []apiGuest
+	for _, g := range s.maskGuests(guests) {
+		out = append(out, apiGuest{
+			Name:        g.Name,
+			AgeBand:     g.AgeBand,
+			Relation:    g.Relation,
+			Nationality: g.nationality(),
+			GovIDType:   g.GovIDType,
+			GovIDNumber: g.GovIDNumber,
+		})
+	}
+	return out
+}
+
+func newAPIToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newAPIHandler(token string) http.Handler {
+	s := &apiServer{token: token}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/openapi.json", s.handleOpenAPI)
+	mux.HandleFunc("GET /api/customers", s.auth(s.handleListCustomers))
+	mux.HandleFunc("POST /api/customers", s.auth(s.handleCreateCustomer))
+	mux.HandleFunc("GET /api/customers/{id}", s.auth(s.handleGetCustomer))
+	mux.HandleFunc("POST /api/bills", s.auth(s.handleCreateBill))
+	mux.HandleFunc("GET /api/bills/{number}", s.auth(s.handleGetBill))
+	mux.HandleFunc("GET /api/bills/{number}/pdf", s.auth(s.handleGetBillPDF))
+	return logRequests(mux)
+}
+
+// auth rejects requests without the bearer token and runs the handlers one
+// at a time, since they share the in-memory databases
+func (s *apiServer) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid API token")
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		next(w, r)
+	}
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		log.Printf("%s %s %s (%v)", r.RemoteAddr, r.Method, r.URL.Path, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// decodeJSON reads a single JSON object from the request body and rejects
+// unknown fields so that typos do not silently drop data
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return fmt.Errorf("invalid JSON body: unexpected data after the object")
+	}
+	return nil
+}
+
+func (s *apiServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+func (s *apiServer) handleListCustomers(w http.ResponseWriter, r *http.Request) {
+	db := NewCustomerDB()
+	customers := db.getCustomers()
+	if q := r.URL.Query().Get("q"); q != "" {
+		customers = db.searchCustomers(q, 0)
+	}
+	settings := loadSettings()
+	masked := []apiCustomer{}
+	for _, c := range customers {
+		masked = append(masked, newAPICustomer(settings, c))
+	}
+	writeJSON(w, http.StatusOK, masked)
+}
+
+func (s *apiServer) handleGetCustomer(w http.ResponseWriter, r *http.Request) {
+	customer, ok := NewCustomerDB().getCustomer(r.PathValue("id"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "customer not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPICustomer(loadSettings(), customer))
+}
+
+func (s *apiServer) handleCreateCustomer(w http.ResponseWriter, r *http.Request) {
+	var req apiCustomerRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	customer, err := req.customer()
+	if err == nil {
+		err = validateCustomer(customer)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.CompanyID != "" {
+		if _, ok := NewCompanyDB().getCompany(req.CompanyID); !ok {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("company %s not found", req.CompanyID))
+			return
+		}
+	}
+
+	db := NewCustomerDB()
+	if r.URL.Query().Get("allow_duplicate") != "true" {
+		if matches := db.findDuplicates(customer); len(matches) > 0 {
+			found := make([]apiDuplicateMatch, len(matches))
+			for i, m := range matches {
+				found[i] = apiDuplicateMatch{ID: m.Customer.ID, Reasons: m.Reasons}
+			}
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":   "the guest may already be registered; repeat with allow_duplicate=true to add anyway",
+				"matches": found,
+			})
+			return
+		}
+	}
+	customer.CompanyID = req.CompanyID
+	customer.AddedOn = time.Now()
+	if err := db.addCustomer(&customer); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "error saving customer: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/api/customers/"+customer.ID)
+	writeJSON(w, http.StatusCreated, newAPICustomer(loadSettings(), customer))
+}
+
+// handleCreateBill accepts the same bill object as a JSON batch file,
+// generates the invoice and responds with the PDF
+func (s *apiServer) handleCreateBill(w http.ResponseWriter, r *http.Request) {
+	var row batchRow
+	if err := decodeJSON(w, r, &row); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	db := NewCustomerDB()
+	billDB := NewBillDB()
+	companyDB := NewCompanyDB()
+
+	if _, err := prepareBatchBill(row, db, companyDB); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, exists := billDB.getBill(row.BillNumber); exists {
+		writeAPIError(w, http.StatusConflict, fmt.Sprintf("bill number %s already exists", row.BillNumber))
+		return
+	}
+
+	result := runBatch([]batchRow{row}, db, billDB, companyDB)[0]
+	if result.Err != nil {
+		writeAPIError(w, http.StatusInternalServerError, result.Err.Error())
+		return
+	}
+
+	data, err := ioutil.ReadFile(result.PDF)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "error reading invoice: "+err.Error())
+		return
+	}
+	w.Header().Set("Location", "/api/bills/"+result.BillNumber)
+	w.Header().Set("X-Bill-Number", result.BillNumber)
+	w.Header().Set("Content-Type", "application/pdf")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+}
+
+func (s *apiServer) handleGetBill(w http.ResponseWriter, r *http.Request) {
+	bill, ok := NewBillDB().getBill(r.PathValue("number"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "bill not found")
+		return
+	}
+
+	amounts := bill.amounts()
+	settings := loadSettings()
+	writeJSON(w, http.StatusOK, apiBill{
+		Bill:     bill,
+		Customer: newAPICustomer(settings, bill.Customer),
+		Guests:   newAPIGuests(settings, bill.Guests),
+		Amounts: apiAmounts{
+			Taxable: amounts.Taxable,
+			IGST:    amounts.IGST,
+			CGST:    amounts.CGST,
+			SGST:    amounts.SGST,
+			Total:   amounts.Total,
+			Paid:    bill.paid(),
+			Balance: bill.balance(),
+		},
+		PDF: "/api/bills/" + bill.BillNumber + "/pdf",
+	})
+}
+
+// handleGetBillPDF returns the stored invoice, regenerating it if the file
+// has been removed from the Invoice folder
+func (s *apiServer) handleGetBillPDF(w http.ResponseWriter, r *http.Request) {
+	bill, ok := NewBillDB().getBill(r.PathValue("number"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "bill not found")
+		return
+	}
+
+	data, err := ioutil.ReadFile(invoicePath(bill.BillNumber))
+	if err != nil {
+		if err := generatePDF(bill); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "error generating PDF: "+err.Error())
+			return
+		}
+		data, err = ioutil.ReadFile(invoicePath(bill.BillNumber))
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "error reading invoice: "+err.Error())
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Write(data)
+}
+
+func runServeCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on")
+	token := fs.String("token", "", "API token (default: the token saved in Settings)")
+	certFile := fs.String("cert", "", "TLS certificate file, to serve HTTPS")
+	keyFile := fs.String("key", "", "TLS key file, to serve HTTPS")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", fs.Arg(0))}
+	}
+
+	if *token == "" {
+		*token = loadSettings().APIToken
+	}
+	if *token == "" {
+		return usageError{"no API token: generate one in Settings or pass --token"}
+	}
+	if len(*token) < minAPITokenLength {
+		return usageError{fmt.Sprintf("API token must be at least %d characters", minAPITokenLength)}
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		return usageError{"--cert and --key must be given together"}
+	}
+
+	// Customers and bills created through the API are recorded as by "api"
+	currentUser = &apiUser
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           newAPIHandler(*token),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+	}
+
+	log.Printf("API listening on %s", *addr)
+	if *certFile != "" {
+		return server.ListenAndServeTLS(*certFile, *keyFile)
+	}
+	return server.ListenAndServe()
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/jung-kurt/gofpdf"
+)
+
+const nightAuditDir = "NightAudit"
+
+// auditRoomLine is the revenue billed for one room type
+type auditRoomLine struct {
+	RoomType string
+	Rooms    int
+	Nights   int
+	Amounts  billAmounts
+}
+
+type auditPayment struct {
+	Mode   string
+	Count  int
+	Amount float64
+}
+
+type auditBalance struct {
+	BillNumber string
+	Customer   string
+	Total      float64
+	Paid       float64
+	Balance    float64
+}
+
+type auditOccupancy struct {
+	RoomType  string
+	Occupied  int
+	Available int
+}
+
+// nightAudit summarises one business date for the close of day
+type nightAudit struct {
+	Date             time.Time
+	Bills            int
+	Rooms            []auditRoomLine
+	Totals           billAmounts
+	Payments         []auditPayment
+	Collected        float64
+	Outstanding      []auditBalance
+	OutstandingTotal float64
+	Occupancy        []auditOccupancy
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// occupies reports whether a room is in use on the night of date. Stays
+// are billed for both the from and the to date, see stayDays.
+func (item RentalItem) occupies(date time.Time) bool {
+	return !date.Before(dateOnly(item.FromDate)) && !date.After(dateOnly(item.ToDate))
+}
+
+// orderedRoomTypes lists the known room types first, then any other room
+// descriptions found on older bills
+func orderedRoomTypes(seen map[string]bool) []string {
+	var types []string
+	for _, t := range roomTypes {
+		types = append(types, t)
+		delete(seen, t)
+	}
+	var others []string
+	for t := range seen {
+		others = append(others, t)
+	}
+	sort.Strings(others)
+	return append(types, others...)
+}
+
+// buildNightAudit collects the bills raised, payments received, balances
+// still due and rooms occupied on the given business date
+func buildNightAudit(bills []Bill, date time.Time, inventory map[string]int) nightAudit {
+	date = dateOnly(date)
+	audit := nightAudit{Date: date}
+
+	revenue := map[string]*auditRoomLine{}
+	occupied := map[string]int{}
+	seen := map[string]bool{}
+	payments := map[string]*auditPayment{}
+
+	for _, bill := range activeBills(bills) {
+		billDate := dateOnly(bill.Date)
+
+		if billDate.Equal(date) {
+			audit.Bills++
+			for _, item := range bill.Items {
+				line := revenue[item.Description]
+				if line == nil {
+					line = &auditRoomLine{RoomType: item.Description}
+					revenue[item.Description] = line
+				}
+				line.Rooms++
+				line.Nights += item.Days
+				line.Amounts = line.Amounts.plus(taxSplit(item.Rate*float64(item.Days), bill.isInterState()))
+				seen[item.Description] = true
+			}
+		}
+
+		for _, item := range bill.Items {
+			if item.occupies(date) {
+				occupied[item.Description]++
+				seen[item.Description] = true
+			}
+		}
+
+		paidToDate := 0.0
+		for _, p := range bill.Payments {
+			paymentDate := dateOnly(p.Date)
+			if paymentDate.After(date) {
+				continue
+			}
+			paidToDate += p.Amount
+			if paymentDate.Equal(date) {
+				line := payments[p.Mode]
+				if line == nil {
+					line = &auditPayment{Mode: p.Mode}
+					payments[p.Mode] = line
+				}
+				line.Count++
+				line.Amount = round2(line.Amount + p.Amount)
+			}
+		}
+
+		if billDate.After(date) {
+			continue
+		}
+		total := bill.amounts().Total
+		if balance := round2(total - paidToDate); balance > 0 {
+			audit.Outstanding = append(audit.Outstanding, auditBalance{
+				BillNumber: bill.BillNumber,
+				Customer:   bill.Customer.Name,
+				Total:      total,
+				Paid:       round2(paidToDate),
+				Balance:    balance,
+			})
+			audit.OutstandingTotal = round2(audit.OutstandingTotal + balance)
+		}
+	}
+
+	for roomType := range inventory {
+		seen[roomType] = true
+	}
+	for _, roomType := range orderedRoomTypes(seen) {
+		if line := revenue[roomType]; line != nil {
+			audit.Rooms = append(audit.Rooms, *line)
+			audit.Totals = audit.Totals.plus(line.Amounts)
+		}
+		audit.Occupancy = append(audit.Occupancy, auditOccupancy{
+			RoomType:  roomType,
+			Occupied:  occupied[roomType],
+			Available: inventory[roomType],
+		})
+	}
+
+	modes := append([]string{}, paymentModes...)
+	for mode := range payments {
+		known := false
+		for _, m := range paymentModes {
+			if mode == m {
+				known = true
+			}
+		}
+		if !known {
+			modes = append(modes, mode)
+		}
+	}
+	for _, mode := range modes {
+		line := auditPayment{Mode: mode}
+		if p := payments[mode]; p != nil {
+			line = *p
+		}
+		audit.Payments = append(audit.Payments, line)
+		audit.Collected = round2(audit.Collected + line.Amount)
+	}
+	return audit
+}
+
+// percent formats occupancy, or "-" when the number of rooms is not set
+func (o auditOccupancy) percent() string {
+	if o.Available == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(o.Occupied)*100/float64(o.Available))
+}
+
+func (audit nightAudit) totalOccupancy() auditOccupancy {
+	total := auditOccupancy{RoomType: "Total"}
+	for _, o := range audit.Occupancy {
+		total.Occupied += o.Occupied
+		total.Available += o.Available
+	}
+	return total
+}
+
+func money(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
+
+// auditTable draws a table with a shaded header row; numeric columns are
+// right aligned
+func auditTable(pdf *gofpdf.Fpdf, widths []float64, header []string, rows [][]string) {
+	pdf.SetFont("Arial", "B", 9)
+	for i, h := range header {
+		pdf.CellFormat(widths[i], 7, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Arial", "", 9)
+	for _, row := range rows {
+		for i, cell := range row {
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 7, cell, "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(4)
+}
+
+func auditHeading(pdf *gofpdf.Fpdf, text string) {
+	pdf.SetFont("Arial", "B", 11)
+	pdf.CellFormat(190, 8, text, "", 1, "", false, 0, "")
+}
+
+func writeNightAuditPDF(audit nightAudit, path string) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFillColor(240, 240, 240)
+
+	pdf.SetFont("Arial", "B", 16)
+	pdf.CellFormat(190, 10, sellerName, "", 1, "C", false, 0, "")
+	pdf.SetFont("Arial", "B", 13)
+	pdf.CellFormat(190, 8, "Night Audit Report", "", 1, "C", false, 0, "")
+	pdf.SetFont("Arial", "", 10)
+	pdf.CellFormat(190, 6, "Business Date: "+audit.Date.Format("02-01-2006"), "", 1, "C", false, 0, "")
+	pdf.CellFormat(190, 6, "Generated: "+time.Now().Format("02-01-2006 15:04"), "", 1, "C", false, 0, "")
+	pdf.Ln(4)
+
+	auditHeading(pdf, fmt.Sprintf("Billed Revenue (%d bill(s))", audit.Bills))
+	var rows [][]string
+	for _, line := range audit.Rooms {
+		rows = append(rows, []string{
+			line.RoomType, strconv.Itoa(line.Rooms), strconv.Itoa(line.Nights),
+			money(line.Amounts.Taxable), money(line.Amounts.Tax()), money(line.Amounts.Total),
+		})
+	}
+	rows = append(rows, []string{
+		"Total", "", "", money(audit.Totals.Taxable), money(audit.Totals.Tax()), money(audit.Totals.Total),
+	})
+	auditTable(pdf, []float64{50, 20, 20, 35, 30, 35},
+		[]string{"Room Type", "Rooms", "Nights", "Taxable", "GST", "Total"}, rows)
+
+	auditHeading(pdf, "Taxes")
+	auditTable(pdf, []float64{50, 35, 35, 35, 35},
+		[]string{"Taxable Value", "CGST", "SGST", "IGST", "Total Tax"},
+		[][]string{{
+			money(audit.Totals.Taxable), money(audit.Totals.CGST), money(audit.Totals.SGST),
+			money(audit.Totals.IGST), money(audit.Totals.Tax()),
+		}})
+
+	auditHeading(pdf, "Payments Received")
+	rows = nil
+	for _, p := range audit.Payments {
+		rows = append(rows, []string{p.Mode, strconv.Itoa(p.Count), money(p.Amount)})
+	}
+	rows = append(rows, []string{"Total", "", money(audit.Collected)})
+	auditTable(pdf, []float64{70, 30, 40}, []string{"Mode", "Receipts", "Amount"}, rows)
+
+	auditHeading(pdf, "Occupancy")
+	rows = nil
+	for _, o := range append(audit.Occupancy, audit.totalOccupancy()) {
+		available := "-"
+		if o.Available > 0 {
+			available = strconv.Itoa(o.Available)
+		}
+		rows = append(rows, []string{o.RoomType, strconv.Itoa(o.Occupied), available, o.percent()})
+	}
+	auditTable(pdf, []float64{70, 30, 30, 30}, []string{"Room Type", "Occupied", "Rooms", "Occupancy"}, rows)
+
+	auditHeading(pdf, "Outstanding Balances")
+	rows = nil
+	for _, b := range audit.Outstanding {
+		rows = append(rows, []string{b.BillNumber, b.Customer, money(b.Total), money(b.Paid), money(b.Balance)})
+	}
+	rows = append(rows, []string{"Total", "", "", "", money(audit.OutstandingTotal)})
+	auditTable(pdf, []float64{30, 60, 35, 30, 35}, []string{"Bill No", "Customer", "Total", "Paid", "Balance"}, rows)
+
+	pdf.Ln(10)
+	pdf.SetFont("Arial", "", 10)
+	pdf.CellFormat(95, 6, "Prepared by", "T", 0, "C", false, 0, "")
+	pdf.CellFormat(95, 6, "Manager", "T", 1, "C", false, 0, "")
+
+	return pdf.OutputFileAndClose(path)
+}
+
+// writeNightAuditCSV writes every figure of the audit as one row so the
+// accountant can filter by section; value is an amount, or the occupancy
+// percentage for occupancy rows
+func writeNightAuditCSV(audit nightAudit, path string) error {
+	date := audit.Date.Format("2006-01-02")
+	var rows [][]string
+	add := func(section, item, count, amount string) {
+		rows = append(rows, []string{date, section, item, count, amount})
+	}
+
+	add("summary", "bills", strconv.Itoa(audit.Bills), "")
+	for _, line := range audit.Rooms {
+		add("revenue", line.RoomType, strconv.Itoa(line.Nights), money(line.Amounts.Taxable))
+	}
+	add("revenue", "total", "", money(audit.Totals.Taxable))
+	add("tax", "cgst", "", money(audit.Totals.CGST))
+	add("tax", "sgst", "", money(audit.Totals.SGST))
+	add("tax", "igst", "", money(audit.Totals.IGST))
+	add("tax", "total", "", money(audit.Totals.Tax()))
+	add("billed", "total", "", money(audit.Totals.Total))
+	for _, p := range audit.Payments {
+		add("payment", p.Mode, strconv.Itoa(p.Count), money(p.Amount))
+	}
+	add("payment", "total", "", money(audit.Collected))
+	for _, b := range audit.Outstanding {
+		add("outstanding", b.BillNumber+" "+b.Customer, "", money(b.Balance))
+	}
+	add("outstanding", "total", strconv.Itoa(len(audit.Outstanding)), money(audit.OutstandingTotal))
+	for _, o := range append(audit.Occupancy, audit.totalOccupancy()) {
+		add("occupancy", o.RoomType, strconv.Itoa(o.Occupied), strings.TrimSuffix(o.percent(), "%"))
+	}
+
+	return writeCSV(path, []string{"business_date", "section", "item", "count", "value"}, rows)
+}
+
+// exportNightAudit writes the PDF and CSV reports for a business date
+func exportNightAudit(bills []Bill, date time.Time) (nightAudit, string, string, error) {
+	audit := buildNightAudit(bills, date, loadSettings().RoomInventory)
+	if err := os.MkdirAll(nightAuditDir, 0755); err != nil {
+		return audit, "", "", err
+	}
+
+	base := filepath.Join(nightAuditDir, "audit_"+audit.Date.Format("2006-01-02"))
+	if err := writeNightAuditPDF(audit, base+".pdf"); err != nil {
+		return audit, "", "", fmt.Errorf("error writing PDF: %v", err)
+	}
+	if err := writeNightAuditCSV(audit, base+".csv"); err != nil {
+		return audit, "", "", fmt.Errorf("error writing CSV: %v", err)
+	}
+	return audit, base + ".pdf", base + ".csv", nil
+}
+
+func (audit nightAudit) summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Bills raised: %d\n", audit.Bills)
+	fmt.Fprintf(&b, "Billed: %s (taxable %s, GST %s)\n",
+		money(audit.Totals.Total), money(audit.Totals.Taxable), money(audit.Totals.Tax()))
+	for _, p := range audit.Payments {
+		fmt.Fprintf(&b, "  %-14s %10s\n", p.Mode, money(p.Amount))
+	}
+	fmt.Fprintf(&b, "Collected: %s\n", money(audit.Collected))
+	fmt.Fprintf(&b, "Outstanding: %s on %d bill(s)\n", money(audit.OutstandingTotal), len(audit.Outstanding))
+	total := audit.totalOccupancy()
+	fmt.Fprintf(&b, "Occupied rooms: %d (%s)\n", total.Occupied, total.percent())
+	return b.String()
+}
+
+func runAuditCommand(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	date := fs.String("date", time.Now().Format("2006-01-02"), "business date, YYYY-MM-DD")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", fs.Arg(0))}
+	}
+
+	businessDate, err := parseCLIDate("date", *date)
+	if err != nil {
+		return err
+	}
+
+	audit, pdfPath, csvPath, err := exportNightAudit(NewBillDB().getBills(), businessDate)
+	if err != nil {
+		return err
+	}
+	fmt.Print(audit.summary())
+	fmt.Println(pdfPath)
+	fmt.Println(csvPath)
+	return nil
+}
+
+func showNightAuditWindow(myApp fyne.App, billDB *BillDB) {
+	window := myApp.NewWindow("Night Audit")
+
+	businessDate := time.Now()
+	datePicker := widget.NewEntry()
+	datePicker.SetText(businessDate.Format("02-01-2006"))
+	datePicker.Disable()
+
+	dateButton := widget.NewButton("Select Business Date", func() {
+		showDatePicker(window, &businessDate, datePicker)
+	})
+
+	summaryGrid := widget.NewTextGrid()
+	statusLabel := widget.NewLabel("")
+
+	runButton := widget.NewButton("Run Night Audit", func() {
+		audit, pdfPath, csvPath, err := exportNightAudit(billDB.getBills(), businessDate)
+		if err != nil {
+			statusLabel.SetText("Error running night audit: " + err.Error())
+			return
+		}
+		summaryGrid.SetText(audit.summary())
+		statusLabel.SetText("Reports saved to " + pdfPath + " and " + csvPath)
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("Business Date:"),
+		datePicker,
+		dateButton,
+		runButton,
+		statusLabel,
+		summaryGrid,
+	)
+
+	window.SetContent(container.NewPadded(content))
+	window.Resize(fyne.NewSize(500, 450))
+	window.Show()
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// The audit log is an append-only file with one JSON entry per line. Each
+// entry's hash covers the previous entry's hash, so editing, removing or
+// reordering entries breaks the chain from that point on. The hashes are
+// keyed with a secret kept outside the data directory, so that a rewritten
+// log cannot be given a new chain, and the head file records the latest
+// entry, so that entries removed from the end are noticed too.
+const (
+	auditLogPath  = "customer_data/audit_log.jsonl"
+	auditHeadPath = "customer_data/audit_log.head"
+)
+
+// auditKeyFileEnv overrides where the audit log key is kept
+const auditKeyFileEnv = "RENTAL_BILLING_AUDIT_KEY_FILE"
+
+// Lines of an encrypted audit log are prefixed with this and base64 encoded
+const auditLogEncryptedPrefix = "enc:"
+
+const (
+	auditCreate = "create"
+	auditUpdate = "update"
+	auditDelete = "delete"
+)
+
+const (
+	auditCustomer = "customer"
+	auditBill     = "bill"
+	auditCompany  = "company"
+	auditRates    = "rates"
+	auditSettings = "settings"
+	auditUser     = "user"
+	auditIDPhoto  = "id_photo"
+	auditRegCard  = "reg_card"
+)
+
+var auditEntities = []string{auditCustomer, auditBill, auditCompany, auditRates, auditSettings, auditUser, auditIDPhoto, auditRegCard}
+
+type auditEntry struct {
+	Seq      int             `json:"seq"`
+	Time     time.Time       `json:"time"`
+	User     string          `json:"user"`
+	Action   string          `json:"action"`
+	Entity   string          `json:"entity"`
+	EntityID string          `json:"entity_id"`
+	Before   json.RawMessage `json:"before,omitempty"`
+	After    json.RawMessage `json:"after,omitempty"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+}
+
+// auditHead is the latest entry, with a MAC so that it cannot be set back
+// to an earlier entry after the log has been cut short
+type auditHead struct {
+	Seq  int    `json:"seq"`
+	Hash string `json:"hash"`
+	MAC  string `json:"mac"`
+}
+
+// computeHash hashes the entry without its own hash field
+func (e auditEntry) computeHash(key []byte) string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	return auditMAC(key, data)
+}
+
+func auditMAC(key, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h auditHead) computeMAC(key []byte) string {
+	return auditMAC(key, []byte(fmt.Sprintf("head %d %s", h.Seq, h.Hash)))
+}
+
+// auditKeyPath is in the user's config directory rather than the data
+// directory, so that a copy of the data alone is not enough to rewrite the log
+func auditKeyPath() (string, error) {
+	if path := os.Getenv(auditKeyFileEnv); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "rental-billing", "audit.key"), nil
+}
+
+// loadAuditKey reads the audit log key. A new key is only created for a
+// log without entries, since the existing ones could not be verified.
+func loadAuditKey(create bool) ([]byte, error) {
+	path, err := auditKeyPath()
+	if err != nil {
+		return nil, fmt.Errorf("no place for the audit log key: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(data)))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if !create {
+		return nil, fmt.Errorf("audit log key %s not found", path)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func readAuditHead() (*auditHead, error) {
+	data, err := ioutil.ReadFile(auditHeadPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var h auditHead
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (e auditEntry) summary() string {
+	return fmt.Sprintf("#%d  %s  %s  %s %s %s", e.Seq, e.Time.Format("02-01-2006 15:04:05"),
+		e.User, e.Action, e.Entity, e.EntityID)
+}
+
+func encodeAuditLine(e auditEntry) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	if dataKey == nil {
+		if encryptionEnabled() {
+			return nil, errDataLocked
+		}
+		return data, nil
+	}
+	sealed, err := sealWithKey(dataKey, data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(auditLogEncryptedPrefix + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+func decodeAuditLine(line []byte) (auditEntry, error) {
+	var e auditEntry
+	if bytes.HasPrefix(line, []byte(auditLogEncryptedPrefix)) {
+		sealed, err := base64.StdEncoding.DecodeString(string(line[len(auditLogEncryptedPrefix):]))
+		if err != nil {
+			return e, err
+		}
+		if line, err = decryptData(sealed); err != nil {
+			return e, err
+		}
+	}
+	err := json.Unmarshal(line, &e)
+	return e, err
+}
+
+// readAuditLog returns every entry in the order written
+func readAuditLog() ([]auditEntry, error) {
+	data, err := ioutil.ReadFile(auditLogPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		e, err := decodeAuditLine(scanner.Bytes())
+		if err != nil {
+			return entries, fmt.Errorf("line %d: %v", n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// logChange records a change made by the current user and then makes it
+// with apply. before and after are nil for creates and deletes respectively.
+func logChange(action, entity, entityID string, before, after interface{}, apply func() error) error {
+	return withDataLock(func() error {
+		return logChangeLocked(action, entity, entityID, before, after, apply)
+	})
+}
+
+// logChangeLocked is logChange for callers that hold the data lock. The
+// entry is written before apply saves the change, and taken back if that
+// fails, so that no change is ever saved without its entry. The sequence
+// number and hash follow the last entry on disk, whichever process wrote it.
+func logChangeLocked(action, entity, entityID string, before, after interface{}, apply func() error) error {
+	entries, err := readAuditLog()
+	if err != nil {
+		return fmt.Errorf("audit log: %v", err)
+	}
+	// Carrying on after a cut would hide it behind a new head
+	head, err := readAuditHead()
+	if err != nil {
+		return fmt.Errorf("audit log head: %v", err)
+	}
+	if head != nil && (head.Seq != len(entries) || len(entries) > 0 && head.Hash != entries[len(entries)-1].Hash) {
+		return fmt.Errorf("the audit log does not end with entry %d of %s, check it with verify-log", head.Seq, auditHeadPath)
+	}
+	key, err := loadAuditKey(len(entries) == 0)
+	if err != nil {
+		return fmt.Errorf("audit log: %v", err)
+	}
+
+	e := auditEntry{
+		Seq:      1,
+		Time:     time.Now(),
+		User:     actingUser(),
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+	}
+	if e.User == "" {
+		e.User = "system"
+	}
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		e.Seq = last.Seq + 1
+		e.PrevHash = last.Hash
+	}
+	if before != nil {
+		if e.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if e.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+	e.Hash = e.computeHash(key)
+
+	line, err := encodeAuditLine(e)
+	if err != nil {
+		return fmt.Errorf("audit log: %v", err)
+	}
+	var size int64
+	if info, err := os.Stat(auditLogPath); err == nil {
+		size = info.Size()
+	}
+	oldHead, err := ioutil.ReadFile(auditHeadPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("audit log: %v", err)
+	}
+	undo := func() {
+		os.Truncate(auditLogPath, size)
+		if oldHead == nil {
+			os.Remove(auditHeadPath)
+		} else {
+			writeFileAtomic(auditHeadPath, oldHead, 0644)
+		}
+	}
+
+	f, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("audit log: %v", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		head := auditHead{Seq: e.Seq, Hash: e.Hash}
+		head.MAC = head.computeMAC(key)
+		var data []byte
+		if data, err = json.Marshal(head); err == nil {
+			err = writeFileAtomic(auditHeadPath, data, 0644)
+		}
+	}
+	if err != nil {
+		undo()
+		return fmt.Errorf("audit log: %v", err)
+	}
+
+	if err := apply(); err != nil {
+		undo()
+		return err
+	}
+	return nil
+}
+
+// verifyAuditLog checks the hash chain and the head, and returns the number
+// of good entries and the latest hash, which can also be noted down to
+// detect the log and its head being set back to an earlier copy
+func verifyAuditLog() (int, string, error) {
+	entries, err := readAuditLog()
+	if err != nil {
+		return len(entries), "", err
+	}
+	head, err := readAuditHead()
+	if err != nil {
+		return 0, "", fmt.Errorf("audit log head: %v", err)
+	}
+	if len(entries) == 0 && head == nil {
+		return 0, "", nil
+	}
+	key, err := loadAuditKey(false)
+	if err != nil {
+		return 0, "", err
+	}
+
+	prevHash := ""
+	for i, e := range entries {
+		if e.Seq != i+1 {
+			return i, prevHash, fmt.Errorf("entry %d has sequence number %d, entries are missing or reordered", i+1, e.Seq)
+		}
+		if e.PrevHash != prevHash {
+			return i, prevHash, fmt.Errorf("entry %d does not follow entry %d, entries are missing or reordered", e.Seq, e.Seq-1)
+		}
+		if !hmac.Equal([]byte(e.computeHash(key)), []byte(e.Hash)) {
+			return i, prevHash, fmt.Errorf("entry %d has been altered", e.Seq)
+		}
+		prevHash = e.Hash
+	}
+
+	switch {
+	case head == nil:
+		return len(entries), prevHash, fmt.Errorf("the head file %s is missing", auditHeadPath)
+	case !hmac.Equal([]byte(head.computeMAC(key)), []byte(head.MAC)):
+		return len(entries), prevHash, fmt.Errorf("the head file %s has been altered", auditHeadPath)
+	case head.Seq > len(entries):
+		return len(entries), prevHash, fmt.Errorf("entries %d to %d have been removed from the end", len(entries)+1, head.Seq)
+	case head.Seq < len(entries) || head.Hash != prevHash:
+		return len(entries), prevHash, fmt.Errorf("the log does not end with entry %d of the head file", head.Seq)
+	}
+	return len(entries), prevHash, nil
+}
+
+// encryptAuditLog rewrites a plain audit log with encrypted lines. The
+// hashes cover the plain entries, so the chain is unaffected.
+func encryptAuditLog() (bool, error) {
+	data, err := ioutil.ReadFile(auditLogPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var out bytes.Buffer
+	changed := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if !bytes.HasPrefix(line, []byte(auditLogEncryptedPrefix)) {
+			sealed, err := sealWithKey(dataKey, line)
+			if err != nil {
+				return false, err
+			}
+			line = []byte(auditLogEncryptedPrefix + base64.StdEncoding.EncodeToString(sealed))
+			changed = true
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if !changed {
+		return false, nil
+	}
+
+	tmp := auditLogPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, out.Bytes(), 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, auditLogPath)
+}
+
+// valuesDiffer compares values as they would be logged, so that nil and
+// empty maps are the same
+func valuesDiffer(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return !bytes.Equal(ja, jb)
+}
+
+// auditSettingsValue leaves the API token and the room rates, which are
+// logged on their own, out of settings entries
+func auditSettingsValue(s Settings) Settings {
+	if s.APIToken != "" {
+		s.APIToken = "(set)"
+	}
+	s.RoomRates = nil
+	return s
+}
+
+// auditUserValue leaves password hashes out of the log
+func auditUserValue(u User) User {
+	u.PasswordHash = ""
+	return u
+}
+
+// auditDisplayValue formats a before or after value for the viewer, masking
+// ID numbers for staff who may not view ID documents
+func auditDisplayValue(entity string, raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "-"
+	}
+	if !can(permViewIDDocuments) {
+		settings := loadSettings()
+		switch entity {
+		case auditCustomer:
+			var c Customer
+			if json.Unmarshal(raw, &c) == nil {
+				raw, _ = json.Marshal(settings.maskCustomer(c))
+			}
+		case auditBill:
+			var b Bill
+			if json.Unmarshal(raw, &b) == nil {
+				b.Customer = settings.maskCustomer(b.Customer)
+				raw, _ = json.Marshal(b)
+			}
+		}
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return out.String()
+}
+
+func showAuditLogWindow(myApp fyne.App) {
+	window := myApp.NewWindow("Audit Log")
+
+	entries, err := readAuditLog()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("failed to read audit log: %v", err), window)
+	}
+
+	// Latest entries first
+	var shown []auditEntry
+	filter := func(entity, query string) {
+		shown = nil
+		query = strings.ToLower(strings.TrimSpace(query))
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			if entity != "" && entity != "all" && e.Entity != entity {
+				continue
+			}
+			if query != "" && !strings.Contains(strings.ToLower(e.summary()), query) {
+				continue
+			}
+			shown = append(shown, e)
+		}
+	}
+	filter("", "")
+
+	detailsLabel := widget.NewLabel("Select an entry to see the change")
+	detailsLabel.Wrapping = fyne.TextWrapWord
+
+	list := widget.NewList(
+		func() int { return len(shown) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(shown[i].summary())
+		},
+	)
+	list.OnSelected = func(i widget.ListItemID) {
+		e := shown[i]
+		detailsLabel.SetText(fmt.Sprintf("%s\nHash: %s\n\nBefore:\n%s\n\nAfter:\n%s",
+			e.summary(), e.Hash, auditDisplayValue(e.Entity, e.Before), auditDisplayValue(e.Entity, e.After)))
+	}
+
+	entitySelect := widget.NewSelect(append([]string{"all"}, auditEntities...), nil)
+	entitySelect.SetSelected("all")
+	searchEntry := widget.NewEntry()
+	searchEntry.SetPlaceHolder("Search by user, action or record ID")
+
+	refresh := func() {
+		filter(entitySelect.Selected, searchEntry.Text)
+		list.UnselectAll()
+		list.Refresh()
+	}
+	entitySelect.OnChanged = func(string) { refresh() }
+	searchEntry.OnChanged = func(string) { refresh() }
+
+	statusLabel := widget.NewLabel("")
+	verifyButton := widget.NewButton("Verify Log", func() {
+		n, head, err := verifyAuditLog()
+		if err != nil {
+			statusLabel.SetText(fmt.Sprintf("TAMPERING DETECTED after %d good entries: %v", n, err))
+			return
+		}
+		statusLabel.SetText(fmt.Sprintf("%d entries verified, latest hash %s", n, shortHash(head)))
+	})
+
+	top := container.NewVBox(
+		container.NewGridWithColumns(2, entitySelect, searchEntry),
+		verifyButton,
+		statusLabel,
+	)
+	split := container.NewVSplit(list, container.NewVScroll(detailsLabel))
+	split.Offset = 0.5
+
+	window.SetContent(container.NewPadded(container.NewBorder(top, nil, nil, nil, split)))
+	window.Resize(fyne.NewSize(700, 700))
+	window.Show()
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 16 {
+		return hash[:16]
+	}
+	return hash
+}
+
+func runVerifyLogCommand(args []string) error {
+	fs := flag.NewFlagSet("verify-log", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", fs.Arg(0))}
+	}
+
+	n, head, err := verifyAuditLog()
+	if err != nil {
+		return fmt.Errorf("audit log verification failed after %d good entries: %v", n, err)
+	}
+	fmt.Printf("%d entries verified\nlatest hash: %s\n", n, head)
+	return nil
+}
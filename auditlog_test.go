@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// writeTestLog logs three changes and returns the lines of the log
+func writeTestLog(t *testing.T) [][]byte {
+	t.Helper()
+	for _, id := range []string{"CUST1", "CUST2", "CUST3"} {
+		if err := logChange(auditCreate, auditCustomer, id, nil, Customer{ID: id}, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(auditLogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+}
+
+func writeLines(t *testing.T, lines [][]byte) {
+	t.Helper()
+	if err := ioutil.WriteFile(auditLogPath, append(bytes.Join(lines, []byte("\n")), '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tamper func(lines [][]byte) [][]byte
+		good   int
+	}{
+		{"untouched", func(lines [][]byte) [][]byte { return lines }, 3},
+		{"edited", func(lines [][]byte) [][]byte {
+			lines[1] = bytes.Replace(lines[1], []byte(`"CUST2"`), []byte(`"CUST9"`), -1)
+			return lines
+		}, 1},
+		{"reordered", func(lines [][]byte) [][]byte {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, 1},
+		{"truncated", func(lines [][]byte) [][]byte { return lines[:2] }, 2},
+		{"rehashed", func(lines [][]byte) [][]byte {
+			// an edited log given a new chain without the key
+			key := []byte("not the audit log key")
+			prev := ""
+			for i, line := range lines {
+				var e auditEntry
+				if err := json.Unmarshal(line, &e); err != nil {
+					t.Fatal(err)
+				}
+				e.EntityID = "CUST9"
+				e.PrevHash = prev
+				e.Hash = e.computeHash(key)
+				prev = e.Hash
+				lines[i], _ = json.Marshal(e)
+			}
+			return lines
+		}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inTempDir(t)
+			writeLines(t, tc.tamper(writeTestLog(t)))
+			n, _, err := verifyAuditLog()
+			if n != tc.good || (err == nil) != (tc.good == 3) {
+				t.Errorf("verifyAuditLog = %d good entries, %v; want %d", n, err, tc.good)
+			}
+		})
+	}
+}
+
+func TestLogChangeTakesBackEntryOfFailedChange(t *testing.T) {
+	inTempDir(t)
+	writeTestLog(t)
+	failed := errors.New("disk full")
+	if err := logChange(auditCreate, auditCustomer, "CUST4", nil, nil, func() error { return failed }); err != failed {
+		t.Fatalf("logChange = %v, want %v", err, failed)
+	}
+	if n, _, err := verifyAuditLog(); n != 3 || err != nil {
+		t.Errorf("verifyAuditLog = %d good entries, %v; want 3", n, err)
+	}
+}
+
+func TestLogChangeRefusesCutLog(t *testing.T) {
+	inTempDir(t)
+	writeLines(t, writeTestLog(t)[:2])
+	if err := logChange(auditCreate, auditCustomer, "CUST4", nil, nil, func() error { return nil }); err == nil {
+		t.Error("a change was logged after the end of the log was cut off")
+	}
+}
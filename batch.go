@@ -0,0 +1,612 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Batch files describe one bill per JSON object, or one room per CSV row.
+// CSV rows that share a bill number are combined into a single bill.
+var batchCSVColumns = []string{
+	"bill_number", "customer_id", "customer_name", "address", "phone", "nationality", "id_type",
+	"id_number", "company_id", "place_of_supply", "adults", "children", "room", "room_number",
+	"rate", "from", "to", "check_in_time", "check_out_time", "purpose", "coming_from", "going_to",
+	"advance", "payment_mode", "gender", "date_of_birth", "passport_expiry", "visa_number",
+	"visa_type", "visa_expiry", "arrived_in_india", "next_destination", "allow_duplicate",
+}
+
+// batchRow is one bill read from a batch file
+type batchRow struct {
+	BillNumber    string         `json:"bill_number"`
+	CustomerID    string         `json:"customer_id"`
+	Customer      *batchCustomer `json:"customer"`
+	CompanyID     string         `json:"company_id"`
+	PlaceOfSupply string         `json:"place_of_supply"`
+	Adults        int            `json:"adults"`
+	Children      int            `json:"children"`
+	Guests        []batchGuest   `json:"guests"`
+	Items         []batchItem    `json:"items"`
+	CheckInTime   string         `json:"check_in_time"`
+	CheckOutTime  string         `json:"check_out_time"`
+	Purpose       string         `json:"purpose"`
+	ComingFrom    string         `json:"coming_from"`
+	GoingTo       string         `json:"going_to"`
+	Advance       float64        `json:"advance"`
+	PaymentMode   string         `json:"payment_mode"`
+
+	// AllowDuplicate adds the inline customer even if they may already be
+	// registered
+	AllowDuplicate bool `json:"allow_duplicate"`
+
+	line     int
+	parseErr error
+}
+
+type batchCustomer struct {
+	Name        string        `json:"name"`
+	Address     string        `json:"address"`
+	Phone       string        `json:"phone"`
+	Nationality string        `json:"nationality"`
+	GovIDType   string        `json:"gov_id_type"`
+	GovIDNumber string        `json:"gov_id_number"`
+	Foreign     *batchForeign `json:"foreign"`
+}
+
+// batchGuest is another occupant of the stay. Guests can only be given in
+// JSON files, and ID photos only in the Create Bill window.
+type batchGuest struct {
+	Name        string        `json:"name"`
+	AgeBand     string        `json:"age_band"`
+	Relation    string        `json:"relation"`
+	Nationality string        `json:"nationality"`
+	GovIDType   string        `json:"gov_id_type"`
+	GovIDNumber string        `json:"gov_id_number"`
+	Foreign     *batchForeign `json:"foreign"`
+}
+
+// batchForeign are the Form C details of a foreign national, with dates
+// written as in the rest of the file
+type batchForeign struct {
+	Gender          string `json:"gender"`
+	DateOfBirth     string `json:"date_of_birth"`
+	PassportExpiry  string `json:"passport_expiry"`
+	VisaNumber      string `json:"visa_number"`
+	VisaType        string `json:"visa_type"`
+	VisaExpiry      string `json:"visa_expiry"`
+	ArrivedInIndia  string `json:"arrived_in_india"`
+	NextDestination string `json:"next_destination"`
+}
+
+type batchItem struct {
+	Room       string  `json:"room"`
+	RoomNumber string  `json:"room_number"`
+	Rate       float64 `json:"rate"`
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+}
+
+// batchResult reports the outcome of one batch row
+type batchResult struct {
+	Line       int
+	BillNumber string
+	PDF        string
+	Err        error
+}
+
+func readBatchFile(path string) ([]batchRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return readBatchJSON(f)
+	}
+	return readBatchCSV(f)
+}
+
+func readBatchJSON(r io.Reader) ([]batchRow, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("batch JSON must be an array of bills: %v", err)
+	}
+
+	rows := make([]batchRow, len(raw))
+	for i, msg := range raw {
+		rows[i].line = i + 1
+		if err := json.Unmarshal(msg, &rows[i]); err != nil {
+			rows[i].parseErr = err
+		}
+	}
+	return rows, nil
+}
+
+func readBatchCSV(r io.Reader) ([]batchRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("batch CSV is empty")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["room"]; !ok {
+		return nil, fmt.Errorf("batch CSV header must include: %s", strings.Join(batchCSVColumns, ","))
+	}
+
+	var rows []batchRow
+	byBillNumber := map[string]int{}
+	for n, record := range records[1:] {
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := batchRow{line: n + 2}
+		number := func(name string) float64 {
+			text := get(name)
+			if text == "" {
+				return 0
+			}
+			v, err := strconv.ParseFloat(text, 64)
+			if err != nil && row.parseErr == nil {
+				row.parseErr = fmt.Errorf("%s %q is not a number", name, text)
+			}
+			return v
+		}
+
+		row.BillNumber = get("bill_number")
+		row.CustomerID = get("customer_id")
+		if get("customer_name") != "" {
+			row.Customer = &batchCustomer{
+				Name:        get("customer_name"),
+				Address:     get("address"),
+				Phone:       get("phone"),
+				Nationality: get("nationality"),
+				GovIDType:   get("id_type"),
+				GovIDNumber: get("id_number"),
+			}
+			foreign := batchForeign{
+				Gender:          get("gender"),
+				DateOfBirth:     get("date_of_birth"),
+				PassportExpiry:  get("passport_expiry"),
+				VisaNumber:      get("visa_number"),
+				VisaType:        get("visa_type"),
+				VisaExpiry:      get("visa_expiry"),
+				ArrivedInIndia:  get("arrived_in_india"),
+				NextDestination: get("next_destination"),
+			}
+			if foreign != (batchForeign{}) {
+				row.Customer.Foreign = &foreign
+			}
+		}
+		if text := get("allow_duplicate"); text != "" {
+			allow, err := strconv.ParseBool(text)
+			if err != nil && row.parseErr == nil {
+				row.parseErr = fmt.Errorf("allow_duplicate %q is not true or false", text)
+			}
+			row.AllowDuplicate = allow
+		}
+		row.CompanyID = get("company_id")
+		row.PlaceOfSupply = get("place_of_supply")
+		row.Adults = int(number("adults"))
+		row.Children = int(number("children"))
+		row.Items = []batchItem{{
+			Room:       get("room"),
+			RoomNumber: get("room_number"),
+			Rate:       number("rate"),
+			From:       get("from"),
+			To:         get("to"),
+		}}
+		row.CheckInTime = get("check_in_time")
+		row.CheckOutTime = get("check_out_time")
+		row.Purpose = get("purpose")
+		row.ComingFrom = get("coming_from")
+		row.GoingTo = get("going_to")
+		row.Advance = number("advance")
+		row.PaymentMode = get("payment_mode")
+
+		// Further rooms of a bill already seen. A bad room fails the whole
+		// bill rather than leaving it out of the invoice.
+		if i, ok := byBillNumber[row.BillNumber]; ok && row.BillNumber != "" {
+			rows[i].Items = append(rows[i].Items, row.Items...)
+			if row.parseErr != nil && rows[i].parseErr == nil {
+				rows[i].parseErr = fmt.Errorf("line %d: %v", row.line, row.parseErr)
+			}
+			continue
+		}
+		if row.BillNumber != "" {
+			byBillNumber[row.BillNumber] = len(rows)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseBatchDate accepts YYYY-MM-DD or the DD-MM-YYYY format shown in the app
+func parseBatchDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "02-01-2006"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD", value)
+}
+
+func (c *batchCustomer) customer() (Customer, error) {
+	foreign, err := c.Foreign.details()
+	if err != nil {
+		return Customer{}, err
+	}
+	return Customer{
+		Name:        c.Name,
+		Address:     c.Address,
+		Phone:       c.Phone,
+		Nationality: strings.TrimSpace(c.Nationality),
+		GovIDType:   c.GovIDType,
+		GovIDNumber: normalizeGovID(c.GovIDNumber),
+		Foreign:     foreign,
+	}, nil
+}
+
+// details parses the Form C details; a nil f gives nil details
+func (f *batchForeign) details() (*ForeignDetails, error) {
+	if f == nil {
+		return nil, nil
+	}
+	d := &ForeignDetails{
+		Gender:          strings.TrimSpace(f.Gender),
+		VisaNumber:      normalizeGovID(f.VisaNumber),
+		VisaType:        strings.TrimSpace(f.VisaType),
+		NextDestination: strings.TrimSpace(f.NextDestination),
+	}
+	dates := []struct {
+		name  string
+		value string
+		date  *time.Time
+	}{
+		{"date_of_birth", f.DateOfBirth, &d.DateOfBirth},
+		{"passport_expiry", f.PassportExpiry, &d.PassportExpiry},
+		{"visa_expiry", f.VisaExpiry, &d.VisaExpiry},
+		{"arrived_in_india", f.ArrivedInIndia, &d.ArrivedInIndia},
+	}
+	for _, field := range dates {
+		value := strings.TrimSpace(field.value)
+		if value == "" {
+			return nil, fmt.Errorf("%s is required for foreign nationals", field.name)
+		}
+		t, err := parseBatchDate(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", field.name, err)
+		}
+		*field.date = t
+	}
+	return d, nil
+}
+
+// prepareBatchBill turns a row into a validated bill without saving anything
+func prepareBatchBill(row batchRow, db *CustomerDB, companyDB *CompanyDB) (Bill, error) {
+	if row.parseErr != nil {
+		return Bill{}, row.parseErr
+	}
+
+	bill := Bill{
+		BillNumber:    row.BillNumber,
+		PlaceOfSupply: row.PlaceOfSupply,
+		Adults:        row.Adults,
+		Children:      row.Children,
+		CheckInTime:   strings.TrimSpace(row.CheckInTime),
+		CheckOutTime:  strings.TrimSpace(row.CheckOutTime),
+		Purpose:       strings.TrimSpace(row.Purpose),
+		ComingFrom:    strings.TrimSpace(row.ComingFrom),
+		GoingTo:       strings.TrimSpace(row.GoingTo),
+		Date:          time.Now(),
+	}
+	for i, g := range row.Guests {
+		foreign, err := g.Foreign.details()
+		if err != nil {
+			return Bill{}, fmt.Errorf("guest %d: %v", i+1, err)
+		}
+		bill.Guests = append(bill.Guests, StayGuest{
+			Name:        strings.TrimSpace(g.Name),
+			AgeBand:     g.AgeBand,
+			Relation:    g.Relation,
+			GovIDType:   g.GovIDType,
+			GovIDNumber: normalizeGovID(g.GovIDNumber),
+			Nationality: strings.TrimSpace(g.Nationality),
+			Foreign:     foreign,
+		})
+	}
+	if bill.PlaceOfSupply == "" {
+		bill.PlaceOfSupply = sellerStateCode
+	}
+
+	switch {
+	case row.CustomerID != "":
+		customer, ok := db.getCustomer(row.CustomerID)
+		if !ok {
+			return Bill{}, fmt.Errorf("customer %s not found", row.CustomerID)
+		}
+		bill.Customer = customer
+	case row.Customer != nil:
+		customer, err := row.Customer.customer()
+		if err == nil {
+			err = validateCustomer(customer)
+		}
+		if err != nil {
+			return Bill{}, err
+		}
+		if matches := db.findDuplicates(customer); len(matches) > 0 && !row.AllowDuplicate {
+			ids := make([]string, len(matches))
+			for i, m := range matches {
+				ids[i] = m.Customer.ID
+			}
+			return Bill{}, fmt.Errorf("the guest may already be registered as %s; give customer_id, or set allow_duplicate to add them anyway",
+				strings.Join(ids, ", "))
+		}
+		// Placeholder until the customer is saved during generation
+		bill.Customer = customer
+		bill.Customer.ID = "NEW"
+	default:
+		return Bill{}, fmt.Errorf("either customer_id or an inline customer is required")
+	}
+
+	if row.CompanyID != "" {
+		company, ok := companyDB.getCompany(row.CompanyID)
+		if !ok {
+			return Bill{}, fmt.Errorf("company %s not found", row.CompanyID)
+		}
+		bill.BillTo = &company
+		bill.GuestGSTIN = company.GSTIN
+	}
+
+	for i, item := range row.Items {
+		from, err := parseBatchDate(item.From)
+		if err != nil {
+			return Bill{}, fmt.Errorf("room %d: from date: %v", i+1, err)
+		}
+		to, err := parseBatchDate(item.To)
+		if err != nil {
+			return Bill{}, fmt.Errorf("room %d: to date: %v", i+1, err)
+		}
+		bill.Items = append(bill.Items, RentalItem{
+			Description: item.Room,
+			Rate:        item.Rate,
+			Days:        stayDays(from, to),
+			FromDate:    from,
+			ToDate:      to,
+			RoomNumber:  strings.TrimSpace(item.RoomNumber),
+		})
+	}
+
+	if row.Advance != 0 {
+		mode := row.PaymentMode
+		if mode == "" {
+			mode = paymentModes[0]
+		}
+		bill.Payments = []Payment{{Mode: mode, Amount: row.Advance, Date: time.Now()}}
+	}
+
+	// Bill numbers are checked once all rows have numbers assigned
+	if bill.BillNumber == "" {
+		bill.BillNumber = "pending"
+	}
+	if err := validateBill(bill); err != nil {
+		return Bill{}, err
+	}
+	settings := loadSettings()
+	for i, item := range bill.Items {
+		if err := settings.checkRoomRate(item); err != nil {
+			return Bill{}, fmt.Errorf("room %d: %v", i+1, err)
+		}
+	}
+	return bill, nil
+}
+
+// runBatch validates every row first and then generates the valid bills.
+// A failing row is reported in its result and does not stop the others.
+func runBatch(rows []batchRow, db *CustomerDB, billDB *BillDB, companyDB *CompanyDB) []batchResult {
+	results := make([]batchResult, len(rows))
+	bills := make([]Bill, len(rows))
+	seen := map[string]bool{}
+
+	for i, row := range rows {
+		results[i] = batchResult{Line: row.line, BillNumber: row.BillNumber}
+		bill, err := prepareBatchBill(row, db, companyDB)
+		if err == nil && row.BillNumber != "" {
+			if _, exists := billDB.getBill(row.BillNumber); exists {
+				err = fmt.Errorf("bill number %s already exists", row.BillNumber)
+			} else if seen[row.BillNumber] {
+				err = fmt.Errorf("bill number %s is repeated in the batch", row.BillNumber)
+			}
+			seen[row.BillNumber] = true
+		}
+		results[i].Err = err
+		bills[i] = bill
+	}
+
+	for i, row := range rows {
+		if results[i].Err != nil {
+			continue
+		}
+		bill := bills[i]
+
+		if row.CustomerID == "" {
+			bill.Customer.AddedOn = time.Now()
+			if err := db.addCustomer(&bill.Customer); err != nil {
+				results[i].Err = fmt.Errorf("error saving customer: %v", err)
+				continue
+			}
+		}
+		// Bills without a number are given the next free one when saved
+		if row.BillNumber == "" {
+			bill.BillNumber = ""
+		}
+		if err := billDB.addBill(&bill); err != nil {
+			results[i].Err = fmt.Errorf("error saving bill: %v", err)
+			continue
+		}
+		results[i].BillNumber = bill.BillNumber
+
+		if err := generatePDF(bill); err != nil {
+			results[i].Err = fmt.Errorf("bill saved but PDF could not be generated: %v", err)
+			continue
+		}
+		results[i].PDF = invoicePath(bill.BillNumber)
+	}
+	return results
+}
+
+// writeBatchReport saves a CSV with one line per batch row
+func writeBatchReport(path string, results []batchResult) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, r := range results {
+		status, detail := "ok", r.PDF
+		if r.Err != nil {
+			status, detail = "error", r.Err.Error()
+		}
+		rows = append(rows, []string{strconv.Itoa(r.Line), r.BillNumber, status, detail})
+	}
+	return writeCSV(path, []string{"line", "bill_number", "status", "detail"}, rows)
+}
+
+func batchSummary(results []batchResult) (ok, failed int) {
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		} else {
+			ok++
+		}
+	}
+	return ok, failed
+}
+
+// importBatchFile runs a batch file end to end and writes its report
+func importBatchFile(path string, db *CustomerDB, billDB *BillDB, companyDB *CompanyDB) ([]batchResult, string, error) {
+	rows, err := readBatchFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	results := runBatch(rows, db, billDB, companyDB)
+
+	report := filepath.Join("Batch", fmt.Sprintf("report_%s.csv", time.Now().Format("20060102_150405")))
+	if err := writeBatchReport(report, results); err != nil {
+		return results, "", fmt.Errorf("error writing report: %v", err)
+	}
+	return results, report, nil
+}
+
+func runBatchCommand(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	file := fs.String("file", "", "CSV or JSON file of bills (required)")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if *file == "" {
+		return usageError{"--file is required"}
+	}
+
+	results, report, err := importBatchFile(*file, NewCustomerDB(), NewBillDB(), NewCompanyDB())
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("line %d: error: %v\n", r.Line, r.Err)
+		} else {
+			fmt.Printf("line %d: %s\n", r.Line, r.PDF)
+		}
+	}
+	ok, failed := batchSummary(results)
+	fmt.Printf("%d bill(s) generated, %d failed; report written to %s\n", ok, failed, report)
+	if failed > 0 {
+		return fmt.Errorf("%d row(s) failed", failed)
+	}
+	return nil
+}
+
+func showBatchImportWindow(myApp fyne.App, db *CustomerDB, billDB *BillDB, companyDB *CompanyDB) {
+	window := myApp.NewWindow("Batch Import")
+
+	resultsGrid := widget.NewTextGrid()
+	statusLabel := widget.NewLabel("")
+
+	importButton := widget.NewButton("Select CSV or JSON File", func() {
+		fd := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			reader.Close()
+
+			results, report, err := importBatchFile(reader.URI().Path(), db, billDB, companyDB)
+			if err != nil {
+				statusLabel.SetText("Error importing batch: " + err.Error())
+				return
+			}
+
+			text := ""
+			for _, r := range results {
+				if r.Err != nil {
+					text += fmt.Sprintf("Line %d: %v\n", r.Line, r.Err)
+				} else {
+					text += fmt.Sprintf("Line %d: %s generated\n", r.Line, r.BillNumber)
+				}
+			}
+			resultsGrid.SetText(text)
+
+			ok, failed := batchSummary(results)
+			statusLabel.SetText(fmt.Sprintf("%d bill(s) generated, %d failed. Report: %s", ok, failed, report))
+		}, window)
+		fd.SetFilter(storage.NewExtensionFileFilter([]string{".csv", ".json"}))
+		fd.Show()
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("CSV columns: "+strings.Join(batchCSVColumns, ", ")),
+		importButton,
+		statusLabel,
+		resultsGrid,
+	)
+
+	window.SetContent(container.NewPadded(container.NewVScroll(content)))
+	window.Resize(fyne.NewSize(600, 500))
+	window.Show()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadBatchCSVFailsWholeBill(t *testing.T) {
+	csv := `bill_number,customer_id,adults,room,rate,from,to
+B1,CUST1,2,AC Room,2500,2026-05-04,2026-05-05
+B1,CUST1,2,NON-AC Room,abc,2026-05-04,2026-05-05
+B2,CUST1,1,AC Room,2500,2026-05-04,2026-05-05
+B2,CUST1,1,AC Room,2000,2026-05-04,2026-05-05
+`
+	rows, err := readBatchCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d bills, want 2", len(rows))
+	}
+	if rows[0].parseErr == nil || !strings.Contains(rows[0].parseErr.Error(), "line 3") {
+		t.Errorf("bill B1 error = %v, want the bad room on line 3", rows[0].parseErr)
+	}
+	if rows[1].parseErr != nil || len(rows[1].Items) != 2 {
+		t.Errorf("bill B2 = %d rooms, error %v", len(rows[1].Items), rows[1].parseErr)
+	}
+}
+
+func TestBatchRefusesDuplicateCustomer(t *testing.T) {
+	inTempDir(t)
+	db := NewCustomerDB()
+	existing := Customer{Name: "Asha Verma", Address: "12 MG Road, Pune", Phone: "9876543210",
+		GovIDType: "Passport", GovIDNumber: "K1234567"}
+	if err := db.addCustomer(&existing); err != nil {
+		t.Fatal(err)
+	}
+
+	row := batchRow{
+		Customer: &batchCustomer{Name: "Asha Verma", Address: "12 MG Road, Pune", Phone: "+91 98765 43210",
+			GovIDType: "Passport", GovIDNumber: "K1234567"},
+		Adults: 1,
+		Items:  []batchItem{{Room: "AC Room", Rate: 2500, From: "2026-05-04", To: "2026-05-05"}},
+	}
+	_, err := prepareBatchBill(row, db, NewCompanyDB())
+	if err == nil || !strings.Contains(err.Error(), existing.ID) {
+		t.Fatalf("returning guest = %v, want a refusal naming %s", err, existing.ID)
+	}
+
+	row.AllowDuplicate = true
+	if _, err := prepareBatchBill(row, db, NewCompanyDB()); err != nil {
+		t.Errorf("allow_duplicate: %v", err)
+	}
+}
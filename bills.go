@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var roomTypes = []string{"NON-AC Room", "AC Room"}
+
+var paymentModes = []string{"Cash", "UPI", "Card", "Bank Transfer"}
+
+// Purposes of visit offered in the Create Bill window; others can be typed
+var visitPurposes = []string{"Business", "Leisure", "Family Visit", "Medical", "Pilgrimage", "Education", "Transit"}
+
+// Check-in and check-out times from the invoice terms, used when a bill
+// does not record the actual times
+const (
+	defaultCheckInTime  = "12:00"
+	defaultCheckOutTime = "11:00"
+)
+
+// atClock returns date at an "HH:MM" time of day
+func atClock(date time.Time, clock, fallback string) time.Time {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		t, _ = time.Parse("15:04", fallback)
+	}
+	d := dateOnly(date)
+	return time.Date(d.Year(), d.Month(), d.Day(), t.Hour(), t.Minute(), 0, 0, d.Location())
+}
+
+// arrival is the check-in date and time of the stay
+func (bill Bill) arrival() time.Time {
+	var first time.Time
+	for _, item := range bill.Items {
+		if first.IsZero() || item.FromDate.Before(first) {
+			first = item.FromDate
+		}
+	}
+	return atClock(first, bill.CheckInTime, defaultCheckInTime)
+}
+
+// departure is the check-out date and time, the morning after the last
+// night billed
+func (bill Bill) departure() time.Time {
+	var last time.Time
+	for _, item := range bill.Items {
+		if item.ToDate.After(last) {
+			last = item.ToDate
+		}
+	}
+	return atClock(last.AddDate(0, 0, 1), bill.CheckOutTime, defaultCheckOutTime)
+}
+
+// nationality defaults to Indian for customers added before it was recorded
+func (c Customer) nationality() string {
+	if c.Nationality == "" {
+		return "Indian"
+	}
+	return c.Nationality
+}
+
+// Payment is an amount received against a bill, either the advance taken
+// when the bill is created or a later payment recorded on it
+type Payment struct {
+	Mode   string    `json:"mode"`
+	Amount float64   `json:"amount"`
+	Date   time.Time `json:"date"`
+	By     string    `json:"by,omitempty"`
+}
+
+func knownPaymentMode(mode string) bool {
+	for _, m := range paymentModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func (bill Bill) paid() float64 {
+	total := 0.0
+	for _, p := range bill.Payments {
+		total += p.Amount
+	}
+	return round2(total)
+}
+
+// balance is the amount still due from the guest
+func (bill Bill) balance() float64 {
+	return round2(bill.amounts().Total - bill.paid())
+}
+
+// Cancellation records who cancelled a bill and why. Cancelled bills are
+// kept for the record but left out of returns and reports.
+type Cancellation struct {
+	Date   time.Time `json:"date"`
+	By     string    `json:"by"`
+	Reason string    `json:"reason"`
+}
+
+func (bill Bill) cancelled() bool {
+	return bill.Cancellation != nil
+}
+
+// activeBills leaves out cancelled bills
+func activeBills(bills []Bill) []Bill {
+	var active []Bill
+	for _, b := range bills {
+		if !b.cancelled() {
+			active = append(active, b)
+		}
+	}
+	return active
+}
+
+// stayDays counts the nights billed for a stay, including both the from
+// and to dates as the Create Bill window does
+func stayDays(from, to time.Time) int {
+	return int(to.Sub(from).Hours()/24) + 1
+}
+
+func validateRentalItem(item RentalItem) error {
+	if item.Description == "" {
+		return fmt.Errorf("please select a room type")
+	}
+	known := false
+	for _, roomType := range roomTypes {
+		if item.Description == roomType {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown room type %q", item.Description)
+	}
+	if item.Rate <= 0 {
+		return fmt.Errorf("please enter a valid rate")
+	}
+	if item.Days < 1 {
+		return fmt.Errorf("to date must be after from date")
+	}
+	return nil
+}
+
+// validateBill applies the rules of the Create Bill window to a complete
+// bill so that every way of creating bills enforces the same checks.
+func validateBill(bill Bill) error {
+	if bill.Customer.ID == "" {
+		return fmt.Errorf("please select a customer")
+	}
+	if len(bill.Items) == 0 {
+		return fmt.Errorf("please add at least one room")
+	}
+	for i, item := range bill.Items {
+		if err := validateRentalItem(item); err != nil {
+			return fmt.Errorf("room %d: %v", i+1, err)
+		}
+	}
+	if bill.BillNumber == "" {
+		return fmt.Errorf("please enter a bill number")
+	}
+	if strings.ContainsAny(bill.BillNumber, `/\`) {
+		return fmt.Errorf("bill number cannot contain / or \\")
+	}
+	if bill.Adults < 1 {
+		return fmt.Errorf("number of adults cannot be zero")
+	}
+	if bill.Children < 0 {
+		return fmt.Errorf("number of children cannot be negative")
+	}
+	if err := validateStayGuests(bill); err != nil {
+		return err
+	}
+	for _, clock := range []string{bill.CheckInTime, bill.CheckOutTime} {
+		if _, err := time.Parse("15:04", clock); clock != "" && err != nil {
+			return fmt.Errorf("check-in and check-out times must be like 14:30")
+		}
+	}
+	if bill.BillTo != nil {
+		if err := validateGSTIN(bill.BillTo.GSTIN); err != nil {
+			return fmt.Errorf("billing company has an %v", err)
+		}
+	}
+	if bill.PlaceOfSupply != sellerStateCode {
+		return fmt.Errorf("place of supply of accommodation must be the property's state %s, not %s",
+			stateLabel(sellerStateCode), bill.PlaceOfSupply)
+	}
+	for _, p := range bill.Payments {
+		if p.Amount < 0 {
+			return fmt.Errorf("please enter a valid advance amount")
+		}
+		if !knownPaymentMode(p.Mode) {
+			return fmt.Errorf("unknown payment mode %q", p.Mode)
+		}
+	}
+	return nil
+}
+
+// BillDB handles storage of generated bills
+type BillDB struct {
+	bills    []Bill
+	filePath string
+	loadErr  error
+}
+
+func NewBillDB() *BillDB {
+	os.MkdirAll("customer_data", 0755)
+
+	db := &BillDB{
+		filePath: "customer_data/bills.json",
+	}
+	db.loadBills()
+	return db
+}
+
+func (db *BillDB) loadBills() error {
+	db.bills = nil
+	db.loadErr = nil
+	data, err := readDataFile(db.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &db.bills)
+	}
+	db.loadErr = err
+	return err
+}
+
+func (db *BillDB) saveBills() error {
+	if db.loadErr != nil {
+		return fmt.Errorf("bills could not be loaded, not saving: %v", db.loadErr)
+	}
+	data, err := json.MarshalIndent(db.bills, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeDataFile(db.filePath, data, 0644)
+}
+
+// change runs fn under the data lock on the bills as saved on disk
+func (db *BillDB) change(fn func() error) error {
+	return withDataLock(func() error {
+		if err := db.loadBills(); err != nil {
+			return fmt.Errorf("bills could not be loaded: %v", err)
+		}
+		return fn()
+	})
+}
+
+// addBill stores a new bill. A bill without a number is given the next
+// free one under the data lock; a number that is already taken is refused,
+// since an issued bill may only change through updateBill.
+func (db *BillDB) addBill(bill *Bill) error {
+	if bill.CreatedBy == "" {
+		bill.CreatedBy = actingUser()
+	}
+	return db.change(func() error {
+		if bill.BillNumber == "" {
+			bill.BillNumber = db.nextBillNumber()
+		}
+		if _, exists := db.getBill(bill.BillNumber); exists {
+			return fmt.Errorf("bill number %s already exists", bill.BillNumber)
+		}
+		db.bills = append(db.bills, *bill)
+		return logChangeLocked(auditCreate, auditBill, bill.BillNumber, nil, *bill, db.saveBills)
+	})
+}
+
+// updateBill applies fn to a stored bill and saves it, for details added
+// after the bill was issued such as its IRN
+func (db *BillDB) updateBill(billNumber string, fn func(bill *Bill) error) error {
+	return db.change(func() error {
+		for i, b := range db.bills {
+			if b.BillNumber != billNumber {
+				continue
+			}
+			updated := b
+			if err := fn(&updated); err != nil {
+				return err
+			}
+			db.bills[i] = updated
+			return logChangeLocked(auditUpdate, auditBill, billNumber, b, updated, db.saveBills)
+		}
+		return fmt.Errorf("bill %s not found", billNumber)
+	})
+}
+
+func (db *BillDB) getBills() []Bill {
+	return db.bills
+}
+
+func (db *BillDB) getBill(billNumber string) (Bill, bool) {
+	for _, b := range db.bills {
+		if b.BillNumber == billNumber {
+			return b, true
+		}
+	}
+	return Bill{}, false
+}
+
+// billsForCustomer returns the bills of one customer, latest first
+func (db *BillDB) billsForCustomer(customerID string) []Bill {
+	var bills []Bill
+	for _, b := range db.bills {
+		if b.Customer.ID == customerID {
+			bills = append(bills, b)
+		}
+	}
+	sort.Slice(bills, func(i, j int) bool {
+		return bills[i].Date.After(bills[j].Date)
+	})
+	return bills
+}
+
+// cancelBill marks a bill as cancelled by the current user
+func (db *BillDB) cancelBill(billNumber, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("please enter the reason for cancelling")
+	}
+	return db.change(func() error {
+		for i, b := range db.bills {
+			if b.BillNumber != billNumber {
+				continue
+			}
+			if b.cancelled() {
+				return fmt.Errorf("bill %s is already cancelled", billNumber)
+			}
+			if b.EInvoice != nil && b.EInvoice.Irn != "" {
+				return fmt.Errorf("bill %s has an IRN, cancel the e-invoice on the IRP first", billNumber)
+			}
+			db.bills[i].Cancellation = &Cancellation{
+				Date:   time.Now(),
+				By:     actingUser(),
+				Reason: strings.TrimSpace(reason),
+			}
+			return logChangeLocked(auditUpdate, auditBill, billNumber, b, db.bills[i], db.saveBills)
+		}
+		return fmt.Errorf("bill %s not found", billNumber)
+	})
+}
+
+// recordPayment adds a payment received against a bill, such as the
+// balance settled at check-out, on behalf of the current user
+func (db *BillDB) recordPayment(billNumber string, mode string, amount float64) error {
+	if amount <= 0 {
+		return fmt.Errorf("please enter a valid amount")
+	}
+	if !knownPaymentMode(mode) {
+		return fmt.Errorf("unknown payment mode %q", mode)
+	}
+	return db.change(func() error {
+		for i, b := range db.bills {
+			if b.BillNumber != billNumber {
+				continue
+			}
+			if b.cancelled() {
+				return fmt.Errorf("bill %s is cancelled", billNumber)
+			}
+			if balance := b.balance(); amount > balance {
+				return fmt.Errorf("₹%.2f is more than the balance of ₹%.2f on bill %s", amount, balance, billNumber)
+			}
+			payment := Payment{Mode: mode, Amount: round2(amount), Date: time.Now(), By: actingUser()}
+			db.bills[i].Payments = append(append([]Payment{}, b.Payments...), payment)
+			return logChangeLocked(auditUpdate, auditBill, billNumber, b, db.bills[i], db.saveBills)
+		}
+		return fmt.Errorf("bill %s not found", billNumber)
+	})
+}
+
+// nextBillNumber suggests an unused bill number for bills created without one
+func (db *BillDB) nextBillNumber() string {
+	for n := len(db.bills) + 1; ; n++ {
+		number := fmt.Sprintf("BILL%d", n)
+		if _, exists := db.getBill(number); !exists {
+			return number
+		}
+	}
+}
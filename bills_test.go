@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestRecordPayment(t *testing.T) {
+	inTempDir(t)
+	billDB := NewBillDB()
+	bill := testB2BBill("B1")
+	bill.Payments = []Payment{{Mode: "Cash", Amount: 1000}}
+	if err := billDB.addBill(&bill); err != nil {
+		t.Fatal(err)
+	}
+	// 2 nights at 2500 plus 18% GST
+	if got := bill.balance(); got != 4900 {
+		t.Fatalf("balance = %.2f, want 4900", got)
+	}
+
+	for _, tc := range []struct {
+		bill, mode string
+		amount     float64
+	}{
+		{"B1", "Cash", 0},
+		{"B1", "Cheque", 100},
+		{"B1", "UPI", 4900.01},
+		{"B2", "UPI", 100},
+	} {
+		if err := billDB.recordPayment(tc.bill, tc.mode, tc.amount); err == nil {
+			t.Errorf("payment of %.2f by %s on %s was accepted", tc.amount, tc.mode, tc.bill)
+		}
+	}
+
+	if err := billDB.recordPayment("B1", "UPI", 4900); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := NewBillDB().getBill("B1")
+	if stored.balance() != 0 || len(stored.Payments) != 2 {
+		t.Fatalf("payments = %+v, balance %.2f", stored.Payments, stored.balance())
+	}
+	if p := stored.Payments[1]; p.Mode != "UPI" || p.By != testAdmin.Username || p.Date.IsZero() {
+		t.Errorf("payment recorded as %+v", p)
+	}
+
+	if err := billDB.cancelBill("B1", "duplicate"); err != nil {
+		t.Fatal(err)
+	}
+	if err := billDB.recordPayment("B1", "Cash", 1); err == nil {
+		t.Error("payment on a cancelled bill was accepted")
+	}
+}
+
+func TestAddBillRefusesTakenNumber(t *testing.T) {
+	inTempDir(t)
+	billDB := NewBillDB()
+	bill := testB2BBill("B1")
+	if err := billDB.addBill(&bill); err != nil {
+		t.Fatal(err)
+	}
+	if err := billDB.cancelBill("B1", "wrong room"); err != nil {
+		t.Fatal(err)
+	}
+
+	again := testB2BBill("B1")
+	if err := billDB.addBill(&again); err == nil {
+		t.Fatal("a second bill B1 was accepted")
+	}
+	if stored, _ := NewBillDB().getBill("B1"); !stored.cancelled() {
+		t.Error("the cancellation of B1 was lost")
+	}
+}
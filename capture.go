@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Files newer than this may still be written by the scanner or phone sync
+const watchFolderSettleTime = 2 * time.Second
+
+// capturedImage is an ID photo taken from a capture source
+type capturedImage struct {
+	data []byte
+	// done is called once the photo is stored, e.g. to clear it from the
+	// watch folder
+	done func() error
+}
+
+// idCaptureSource is a device that ID photos can be taken from instead of
+// choosing a file
+type idCaptureSource interface {
+	name() string
+	capture() (capturedImage, error)
+}
+
+// idCaptureSources returns the capture sources configured in settings
+func idCaptureSources(settings Settings) []idCaptureSource {
+	var sources []idCaptureSource
+	if settings.IDCaptureFolder != "" {
+		sources = append(sources, watchFolderSource{dir: settings.IDCaptureFolder})
+	}
+	if webcamSupported && settings.WebcamDevice != "" {
+		sources = append(sources, webcamSource{device: settings.WebcamDevice})
+	}
+	return sources
+}
+
+// watchFolderSource picks up the newest image dropped into a directory by a
+// scanner or phone sync
+type watchFolderSource struct {
+	dir string
+}
+
+func (s watchFolderSource) name() string {
+	return "Scan Folder"
+}
+
+func (s watchFolderSource) capture() (capturedImage, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return capturedImage{}, fmt.Errorf("cannot read scan folder: %v", err)
+	}
+
+	var newest string
+	var newestTime time.Time
+	for _, f := range files {
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if f.IsDir() || (ext != ".jpg" && ext != ".jpeg" && ext != ".png") {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(newestTime) {
+			newest = filepath.Join(s.dir, f.Name())
+			newestTime = info.ModTime()
+		}
+	}
+	if newest == "" {
+		return capturedImage{}, fmt.Errorf("no image found in %s, please scan the ID first", s.dir)
+	}
+	if time.Since(newestTime) < watchFolderSettleTime {
+		return capturedImage{}, fmt.Errorf("%s is still being copied, please try again", filepath.Base(newest))
+	}
+
+	data, err := ioutil.ReadFile(newest)
+	if err != nil {
+		return capturedImage{}, err
+	}
+	// The scan is removed once stored so it is not picked up for the next guest
+	return capturedImage{
+		data: data,
+		done: func() error { return os.Remove(newest) },
+	}, nil
+}
+
+// saveIDPhoto stores a processed ID photo in the photo directory, encrypted
+// if enabled, and returns its path
+func saveIDPhoto(data []byte) (string, error) {
+	if err := os.MkdirAll(idPhotosDir, 0755); err != nil {
+		return "", err
+	}
+	// Create a unique filename for the photo
+	photoFileName := fmt.Sprintf("%s/id_%d.jpg", idPhotosDir, time.Now().UnixNano())
+	if err := writeDataFile(photoFileName, data, 0644); err != nil {
+		return "", err
+	}
+	return photoFileName, nil
+}
+
+// storeIDImage saves a picked ID image and clears it from its source
+func storeIDImage(window fyne.Window, img capturedImage, onSaved func(path string)) {
+	path, err := saveIDPhoto(img.data)
+	if err != nil {
+		dialog.ShowError(err, window)
+		return
+	}
+	if img.done != nil {
+		if err := img.done(); err != nil {
+			dialog.ShowError(fmt.Errorf("photo saved, but the scan could not be removed: %v", err), window)
+		}
+	}
+	onSaved(path)
+}
+
+// pickIDImage gets an ID image from a file, or from a capture source if any
+// is configured, and passes it on processed
+func pickIDImage(window fyne.Window, onPicked func(img capturedImage)) {
+	sources := idCaptureSources(loadSettings())
+	if len(sources) == 0 {
+		chooseIDPhotoFile(window, onPicked)
+		return
+	}
+
+	var d dialog.Dialog
+	buttons := container.NewVBox(widget.NewButton("Choose File", func() {
+		d.Hide()
+		chooseIDPhotoFile(window, onPicked)
+	}))
+	for _, source := range sources {
+		source := source
+		buttons.Add(widget.NewButton("From "+source.name(), func() {
+			d.Hide()
+			captureIDPhoto(window, source, onPicked)
+		}))
+	}
+	d = dialog.NewCustom("ID Photo", "Cancel", buttons, window)
+	d.Show()
+}
+
+// captureIDPhoto takes a photo from the source and passes it on once staff
+// confirm it in a preview
+func captureIDPhoto(window fyne.Window, source idCaptureSource, onPicked func(img capturedImage)) {
+	img, err := source.capture()
+	if err != nil {
+		dialog.ShowError(err, window)
+		return
+	}
+	if img.data, err = processIDPhoto(img.data); err != nil {
+		dialog.ShowError(err, window)
+		return
+	}
+
+	preview := idPhotoPreview()
+	preview.Resource = fyne.NewStaticResource("capture.jpg", img.data)
+	d := dialog.NewCustomConfirm("ID Photo from "+source.name(), "Use Photo", "Cancel", preview, func(ok bool) {
+		if ok {
+			onPicked(img)
+		}
+	}, window)
+	d.Show()
+}
+
+// idPhotoPreview is an image sized for previewing an ID card
+func idPhotoPreview() *canvas.Image {
+	preview := canvas.NewImageFromResource(nil)
+	preview.FillMode = canvas.ImageFillContain
+	preview.SetMinSize(fyne.NewSize(360, 230))
+	return preview
+}
+
+// showIDPhotoPreview shows a stored, possibly encrypted, ID photo in preview
+func showIDPhotoPreview(preview *canvas.Image, path string) {
+	data, err := readDataFile(path)
+	if err != nil {
+		preview.Resource = nil
+	} else {
+		preview.Resource = fyne.NewStaticResource(filepath.Base(path), data)
+	}
+	preview.Refresh()
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	cliUserEnv     = "RENTAL_BILLING_USER"
+	cliPasswordEnv = "RENTAL_BILLING_PASSWORD"
+)
+
+// cliCommand is a sub-command of the headless command-line mode. Commands
+// with a permission are run by a staff member who has to log in first.
+type cliCommand struct {
+	name    string
+	summary string
+	perm    permission
+	run     func(args []string) error
+}
+
+// usageError marks errors caused by bad command-line arguments
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func cliCommands() []cliCommand {
+	return []cliCommand{
+		{"bill", "generate an invoice PDF for an existing customer", permCreateBills, runBillCommand},
+		{"payment", "record a payment received against an existing bill", permRecordPayments, runPaymentCommand},
+		{"batch", "generate invoices for every bill in a CSV or JSON file", permCreateBills, runBatchCommand},
+		{"audit", "write the night audit PDF and CSV for a business date", permExportData, runAuditCommand},
+		{"register", "write the guest register PDF and CSV for a range of arrival dates", permExportData, runRegisterCommand},
+		{"regcard", "write the registration card PDF of a bill for the guest to sign", permCreateBills, runRegCardCommand},
+		{"encrypt", "encrypt customer data and ID photos in place", permManageSettings, runEncryptCommand},
+		{"verify-log", "check the audit log for tampering", "", runVerifyLogCommand},
+		{"purge-photos", "remove ID photos past the retention period, orphaned photos and printed registration cards", permManageSettings, runPurgePhotosCommand},
+		{"serve", "run the HTTP/JSON API for the website and reception tablet", permManageSettings, runServeCommand},
+	}
+}
+
+// runCLI runs a command-line invocation and returns the process exit code:
+// 0 on success, 1 when the command fails and 2 for invalid arguments.
+func runCLI(args []string) int {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	for _, cmd := range cliCommands() {
+		if cmd.name != name {
+			continue
+		}
+		// Every command but encrypt needs encrypted data unlocked first
+		if cmd.name != "encrypt" {
+			if err := unlockFromEnv(); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				return 1
+			}
+		}
+		if cmd.perm != "" {
+			user, err := cliLogin()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				return 1
+			}
+			if !user.can(cmd.perm) {
+				fmt.Fprintf(os.Stderr, "%s: the role of %s does not allow this command\n", name, user.Username)
+				return 1
+			}
+			currentUser = &user
+		}
+		err := cmd.run(args[1:])
+		var usageErr usageError
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.As(err, &usageErr):
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return 2
+		default:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage(os.Stderr)
+	return 2
+}
+
+// cliLogin authenticates the staff member running a command. The username
+// comes from the environment; the password too when running from scripts,
+// otherwise it is asked for.
+func cliLogin() (User, error) {
+	username := os.Getenv(cliUserEnv)
+	if username == "" {
+		return User{}, fmt.Errorf("set %s to your staff username", cliUserEnv)
+	}
+	password := os.Getenv(cliPasswordEnv)
+	if password == "" {
+		var err error
+		if password, err = readSecret(fmt.Sprintf("Password for %s: ", username)); err != nil {
+			return User{}, fmt.Errorf("no password given")
+		}
+	}
+	return NewUserDB().authenticate(username, password)
+}
+
+// stdin is shared so that lines read ahead by one prompt are there for the next
+var stdin = bufio.NewReader(os.Stdin)
+
+// readSecret asks for a password or passphrase on stderr. It is not echoed
+// when typed at a terminal and read as a line when piped in.
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		secret, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		return string(secret), nil
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: rental-billing [command] [flags]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Without a command the desktop application is started.")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range cliCommands() {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Run 'rental-billing [command] -h' for the flags of a command.")
+	fmt.Fprintln(w, "")
+	fmt.Fprintf(w, "Commands other than verify-log run as the staff account in %s,\n", cliUserEnv)
+	fmt.Fprintf(w, "with the password from %s or asked for.\n", cliPasswordEnv)
+}
+
+// parseCLIDate reads a YYYY-MM-DD date in local time
+func parseCLIDate(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, usageError{fmt.Sprintf("--%s is required", name)}
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, usageError{fmt.Sprintf("--%s must be a date like 2026-10-01", name)}
+	}
+	return t, nil
+}
+
+func runBillCommand(args []string) error {
+	fs := flag.NewFlagSet("bill", flag.ContinueOnError)
+	customerID := fs.String("customer", "", "customer ID, e.g. CUST12 (required)")
+	companyID := fs.String("company", "", "company ID to bill to, e.g. COMP3")
+	billNumber := fs.String("bill-number", "", "bill number (default: next free BILL<n>)")
+	room := fs.String("room", "", "room type: \"NON-AC Room\" or \"AC Room\" (required)")
+	rate := fs.Float64("rate", 0, "rate per day (required)")
+	from := fs.String("from", "", "from date, YYYY-MM-DD (required)")
+	to := fs.String("to", "", "to date, YYYY-MM-DD (required)")
+	adults := fs.Int("adults", 0, "number of adults (required)")
+	children := fs.Int("children", 0, "number of children")
+	advance := fs.Float64("advance", 0, "advance paid")
+	paymentMode := fs.String("payment-mode", paymentModes[0], "mode of the advance payment")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", fs.Arg(0))}
+	}
+
+	if *customerID == "" {
+		return usageError{"--customer is required"}
+	}
+	fromDate, err := parseCLIDate("from", *from)
+	if err != nil {
+		return err
+	}
+	toDate, err := parseCLIDate("to", *to)
+	if err != nil {
+		return err
+	}
+
+	db := NewCustomerDB()
+	billDB := NewBillDB()
+	companyDB := NewCompanyDB()
+
+	customer, ok := db.getCustomer(*customerID)
+	if !ok {
+		return fmt.Errorf("customer %s not found", *customerID)
+	}
+
+	var billTo *Company
+	var guestGSTIN string
+	if *companyID != "" {
+		company, ok := companyDB.getCompany(*companyID)
+		if !ok {
+			return fmt.Errorf("company %s not found", *companyID)
+		}
+		billTo = &company
+		guestGSTIN = company.GSTIN
+	}
+
+	var payments []Payment
+	if *advance != 0 {
+		payments = append(payments, Payment{Mode: *paymentMode, Amount: *advance, Date: time.Now()})
+	}
+
+	bill := Bill{
+		BillNumber:    *billNumber,
+		Customer:      customer,
+		BillTo:        billTo,
+		GuestGSTIN:    guestGSTIN,
+		PlaceOfSupply: sellerStateCode,
+		Adults:        *adults,
+		Children:      *children,
+		Items: []RentalItem{{
+			Description: *room,
+			Rate:        *rate,
+			Days:        stayDays(fromDate, toDate),
+			FromDate:    fromDate,
+			ToDate:      toDate,
+		}},
+		Payments: payments,
+		Date:     time.Now(),
+	}
+
+	// Without --bill-number the next free number is given out when saving
+	checked := bill
+	if checked.BillNumber == "" {
+		checked.BillNumber = billDB.nextBillNumber()
+	}
+	if err := validateBill(checked); err != nil {
+		return fmt.Errorf("invalid bill: %v", err)
+	}
+	if err := loadSettings().checkRoomRate(bill.Items[0]); err != nil {
+		return err
+	}
+	if err := billDB.addBill(&bill); err != nil {
+		return fmt.Errorf("error saving bill: %v", err)
+	}
+	if err := generatePDF(bill); err != nil {
+		return fmt.Errorf("bill %s saved but PDF could not be generated: %v", bill.BillNumber, err)
+	}
+
+	fmt.Println(invoicePath(bill.BillNumber))
+	return nil
+}
+
+func runPaymentCommand(args []string) error {
+	fs := flag.NewFlagSet("payment", flag.ContinueOnError)
+	billNumber := fs.String("bill", "", "bill number (required)")
+	amount := fs.Float64("amount", 0, "amount received (required)")
+	mode := fs.String("mode", paymentModes[0], "payment mode")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", fs.Arg(0))}
+	}
+	if *billNumber == "" {
+		return usageError{"--bill is required"}
+	}
+
+	billDB := NewBillDB()
+	if err := billDB.recordPayment(*billNumber, *mode, *amount); err != nil {
+		return err
+	}
+	bill, _ := billDB.getBill(*billNumber)
+	if err := generatePDF(bill); err != nil {
+		return fmt.Errorf("payment recorded but PDF could not be regenerated: %v", err)
+	}
+	fmt.Printf("%s balance %.2f\n", invoicePath(bill.BillNumber), bill.balance())
+	return nil
+}
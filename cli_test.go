@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBillCommandKeepsStandardRate(t *testing.T) {
+	inTempDir(t)
+	customer := Customer{Name: "Ravi Kumar", Phone: "9876543210", Address: "12 Anna Salai, Chennai"}
+	if err := NewCustomerDB().addCustomer(&customer); err != nil {
+		t.Fatal(err)
+	}
+	settings := loadSettings()
+	settings.RoomRates = map[string]float64{"AC Room": 2500}
+	if err := saveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	frontDesk := User{Username: "desk", Name: "Front Desk", Role: roleFrontDesk}
+	currentUser = &frontDesk
+	err := runBillCommand([]string{"--customer", customer.ID, "--room", "AC Room", "--rate", "1500",
+		"--from", "2026-05-04", "--to", "2026-05-05", "--adults", "1"})
+	if err == nil || !strings.Contains(err.Error(), "standard rate") {
+		t.Fatalf("front desk billed below the standard rate: %v", err)
+	}
+	if bills := NewBillDB().getBills(); len(bills) != 0 {
+		t.Errorf("bill saved despite the rate: %+v", bills)
+	}
+}
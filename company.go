@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Company is a billing entity that corporate guests can invoice to
+type Company struct {
+	ID        string    `json:"id"`
+	LegalName string    `json:"legal_name"`
+	GSTIN     string    `json:"gstin"`
+	Address   string    `json:"address"`
+	StateCode string    `json:"state_code"`
+	AddedOn   time.Time `json:"added_on"`
+}
+
+func (c Company) label() string {
+	return fmt.Sprintf("%s - %s (%s)", c.ID, c.LegalName, c.GSTIN)
+}
+
+// CompanyDB handles storage of the company master
+type CompanyDB struct {
+	companies []Company
+	filePath  string
+}
+
+func NewCompanyDB() *CompanyDB {
+	os.MkdirAll("customer_data", 0755)
+
+	db := &CompanyDB{
+		filePath: "customer_data/companies.json",
+	}
+	db.loadCompanies()
+	return db
+}
+
+func (db *CompanyDB) loadCompanies() error {
+	db.companies = nil
+	data, err := ioutil.ReadFile(db.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &db.companies)
+}
+
+func (db *CompanyDB) saveCompanies() error {
+	data, err := json.MarshalIndent(db.companies, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(db.filePath, data, 0644)
+}
+
+// addCompany saves a new company and sets its ID, given out under the data
+// lock like customer IDs
+func (db *CompanyDB) addCompany(company *Company) error {
+	return withDataLock(func() error {
+		if err := db.loadCompanies(); err != nil {
+			return fmt.Errorf("companies could not be loaded: %v", err)
+		}
+		for _, c := range db.companies {
+			if c.GSTIN == company.GSTIN {
+				return fmt.Errorf("company with GSTIN %s already exists (%s)", company.GSTIN, c.ID)
+			}
+		}
+		company.ID = fmt.Sprintf("COMP%d", len(db.companies)+1)
+		db.companies = append(db.companies, *company)
+		return logChangeLocked(auditCreate, auditCompany, company.ID, nil, *company, db.saveCompanies)
+	})
+}
+
+func (db *CompanyDB) getCompanies() []Company {
+	return db.companies
+}
+
+func (db *CompanyDB) getCompany(id string) (Company, bool) {
+	for _, c := range db.companies {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Company{}, false
+}
+
+// companyOptions returns select options for the company master with a
+// leading "None" entry for guests billed in their own name.
+func companyOptions(companies []Company) []string {
+	options := []string{"None"}
+	for _, c := range companies {
+		options = append(options, c.label())
+	}
+	return options
+}
+
+func showAddCompanyWindow(myApp fyne.App, companyDB *CompanyDB) {
+	window := myApp.NewWindow("Add Company")
+
+	legalNameEntry := widget.NewEntry()
+	legalNameEntry.SetPlaceHolder("Legal Name")
+
+	gstinEntry := widget.NewEntry()
+	gstinEntry.SetPlaceHolder("GSTIN")
+
+	addressEntry := widget.NewMultiLineEntry()
+	addressEntry.SetPlaceHolder("Registered Address")
+
+	stateLabelWidget := widget.NewLabel("State: -")
+	gstinEntry.OnChanged = func(text string) {
+		code := stateCodeFromGSTIN(strings.ToUpper(strings.TrimSpace(text)))
+		if name, ok := gstStates[code]; ok {
+			stateLabelWidget.SetText(fmt.Sprintf("State: %s (%s)", name, code))
+			return
+		}
+		stateLabelWidget.SetText("State: -")
+	}
+
+	statusLabel := widget.NewLabel("")
+
+	saveButton := widget.NewButton("Save Company", func() {
+		gstin := strings.ToUpper(strings.TrimSpace(gstinEntry.Text))
+		if legalNameEntry.Text == "" || gstin == "" || addressEntry.Text == "" {
+			statusLabel.SetText("Please fill in all fields")
+			return
+		}
+		if err := validateGSTIN(gstin); err != nil {
+			statusLabel.SetText(err.Error())
+			return
+		}
+
+		company := Company{
+			LegalName: legalNameEntry.Text,
+			GSTIN:     gstin,
+			Address:   addressEntry.Text,
+			StateCode: stateCodeFromGSTIN(gstin),
+			AddedOn:   time.Now(),
+		}
+
+		if err := companyDB.addCompany(&company); err != nil {
+			statusLabel.SetText("Error saving company: " + err.Error())
+			return
+		}
+
+		statusLabel.SetText("Company saved successfully!")
+
+		legalNameEntry.SetText("")
+		gstinEntry.SetText("")
+		addressEntry.SetText("")
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("Add Company"),
+		legalNameEntry,
+		gstinEntry,
+		stateLabelWidget,
+		addressEntry,
+		saveButton,
+		statusLabel,
+	)
+
+	window.SetContent(container.NewPadded(content))
+	window.Resize(fyne.NewSize(400, 400))
+	window.Show()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Names at least this similar are reported as a possible returning guest
+const nameSimilarityThreshold = 0.85
+
+// duplicateMatch is an existing customer that may be the same person
+type duplicateMatch struct {
+	Customer Customer `json:"customer"`
+	Reasons  []string `json:"reasons"`
+}
+
+// normalizePhone keeps the last ten digits so that "+91 98765 43210",
+// "098765-43210" and "9876543210" compare equal
+func normalizePhone(phone string) string {
+	var digits []rune
+	for _, r := range phone {
+		if unicode.IsDigit(r) {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return string(digits)
+}
+
+// normalizeName lower-cases a name and sorts its words, so that
+// "Kumar, Ravi" and "ravi kumar" compare equal
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// nameSimilarity is 1 for equal names and falls towards 0 with the edit
+// distance between them
+func nameSimilarity(a, b string) float64 {
+	ra, rb := []rune(normalizeName(a)), []rune(normalizeName(b))
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 0
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+// findDuplicates returns the saved customers sharing the phone number or
+// government ID of customer, or with a very similar name
+func (db *CustomerDB) findDuplicates(customer Customer) []duplicateMatch {
+	phone := normalizePhone(customer.Phone)
+	idNumber := normalizeSearch(customer.GovIDNumber)
+
+	var matches []duplicateMatch
+	for _, c := range db.customers {
+		var reasons []string
+		if idNumber != "" && c.GovIDType == customer.GovIDType && normalizeSearch(c.GovIDNumber) == idNumber {
+			reasons = append(reasons, "same "+c.GovIDType+" number")
+		}
+		if phone != "" && normalizePhone(c.Phone) == phone {
+			reasons = append(reasons, "same phone number")
+		}
+		if nameSimilarity(c.Name, customer.Name) >= nameSimilarityThreshold {
+			reasons = append(reasons, "similar name")
+		}
+		if len(reasons) > 0 {
+			matches = append(matches, duplicateMatch{Customer: c, Reasons: reasons})
+		}
+	}
+
+	// Matches on more fields are the likelier returning guests
+	sort.SliceStable(matches, func(i, j int) bool {
+		return len(matches[i].Reasons) > len(matches[j].Reasons)
+	})
+	return matches
+}
+
+// showDuplicatesDialog lists possible returning guests. Staff can open an
+// existing record with onOpen, or confirm that this is a new guest with
+// onSaveNew.
+func showDuplicatesDialog(window fyne.Window, matches []duplicateMatch, onOpen func(Customer), onSaveNew func()) {
+	rows := container.NewVBox(widget.NewLabel("This guest may already be registered:"))
+
+	var d dialog.Dialog
+	for _, m := range matches {
+		existing := m.Customer
+		rows.Add(container.NewBorder(nil, nil, nil,
+			widget.NewButton("Open Record", func() {
+				d.Hide()
+				onOpen(existing)
+			}),
+			widget.NewLabel(customerLabel(existing)+"\n"+strings.Join(m.Reasons, ", ")),
+		))
+	}
+	rows.Add(widget.NewButton("Save as New Customer", func() {
+		d.Hide()
+		onSaveNew()
+	}))
+
+	d = dialog.NewCustom("Possible Returning Guest", "Cancel", container.NewVScroll(rows), window)
+	d.Resize(fyne.NewSize(500, 400))
+	d.Show()
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// customerHistory is the lifetime summary of a guest's bills
+type customerHistory struct {
+	Bills       []Bill
+	Nights      int
+	Spend       float64
+	Outstanding float64
+	LastVisit   time.Time
+}
+
+func buildCustomerHistory(bills []Bill) customerHistory {
+	h := customerHistory{Bills: activeBills(bills)}
+	for _, bill := range h.Bills {
+		for _, item := range bill.Items {
+			h.Nights += item.Days
+			if item.ToDate.After(h.LastVisit) {
+				h.LastVisit = item.ToDate
+			}
+		}
+		h.Spend = round2(h.Spend + bill.amounts().Total)
+		if balance := bill.balance(); balance > 0 {
+			h.Outstanding = round2(h.Outstanding + balance)
+		}
+	}
+	return h
+}
+
+func (h customerHistory) summary() string {
+	lastVisit := "-"
+	if !h.LastVisit.IsZero() {
+		lastVisit = h.LastVisit.Format("02-01-2006")
+	}
+	return fmt.Sprintf("Stays: %d\nTotal nights: %d\nTotal spend: ₹%.2f\nLast visit: %s\nOutstanding dues: ₹%.2f",
+		len(h.Bills), h.Nights, h.Spend, lastVisit, h.Outstanding)
+}
+
+func billHistoryLine(bill Bill) string {
+	var rooms []string
+	for _, item := range bill.Items {
+		rooms = append(rooms, fmt.Sprintf("%s x %d", item.Description, item.Days))
+	}
+	period := ""
+	if len(bill.Items) > 0 {
+		period = bill.Items[0].FromDate.Format("02-01-2006") + " to " +
+			bill.Items[len(bill.Items)-1].ToDate.Format("02-01-2006")
+	}
+	line := fmt.Sprintf("%s  %s  %s  ₹%.2f", bill.BillNumber, period, strings.Join(rooms, ", "), bill.amounts().Total)
+	if bill.cancelled() {
+		line += "  (cancelled)"
+	} else if balance := bill.balance(); balance > 0 {
+		line += fmt.Sprintf("  (due ₹%.2f)", balance)
+	}
+	return line
+}
+
+func showCustomerListWindow(myApp fyne.App, db *CustomerDB, billDB *BillDB, companyDB *CompanyDB) {
+	window := myApp.NewWindow("Customers")
+
+	customers := db.getCustomers()
+	if len(customers) == 0 {
+		dialog.ShowInformation("No Customers", "Please add customers first", window)
+		return
+	}
+
+	shown := customers
+	list := widget.NewList(
+		func() int { return len(shown) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(customerLabel(shown[i]))
+		},
+	)
+	list.OnSelected = func(i widget.ListItemID) {
+		showCustomerProfileWindow(myApp, db, billDB, companyDB, shown[i].ID)
+		list.UnselectAll()
+	}
+
+	searchEntry := widget.NewEntry()
+	searchEntry.SetPlaceHolder("Search by name, phone, customer ID or ID number")
+	searchEntry.OnChanged = func(query string) {
+		if strings.TrimSpace(query) == "" {
+			shown = customers
+		} else {
+			shown = db.searchCustomers(query, 0)
+		}
+		list.Refresh()
+	}
+
+	top := container.NewVBox(searchEntry, widget.NewLabel("Select a customer to view the profile:"))
+	content := container.NewBorder(top, nil, nil, nil, list)
+	window.SetContent(container.NewPadded(content))
+	window.Resize(fyne.NewSize(400, 500))
+	window.Show()
+}
+
+func showCustomerProfileWindow(myApp fyne.App, db *CustomerDB, billDB *BillDB, companyDB *CompanyDB, customerID string) {
+	customer, ok := db.getCustomer(customerID)
+	if !ok {
+		return
+	}
+	window := myApp.NewWindow("Customer Profile - " + customer.Name)
+
+	profileDetails := func(idNumber string) string {
+		details := fmt.Sprintf("%s - %s\nPhone: %s\nAddress: %s\n%s: %s\nCustomer since: %s",
+			customer.ID, customer.Name, customer.Phone, customer.Address,
+			customer.GovIDType, idNumber, customer.AddedOn.Format("02-01-2006"))
+		if company, ok := companyDB.getCompany(customer.CompanyID); ok {
+			details += "\nBilled to: " + company.label()
+		}
+		if customer.Foreign != nil {
+			details += "\nNationality: " + customer.nationality() + "\n" + foreignDetailsText(customer.Foreign)
+		}
+		return details
+	}
+	detailsLabel := widget.NewLabel(profileDetails(loadSettings().maskGovID(customer.GovIDType, customer.GovIDNumber)))
+
+	// Full ID numbers and photos are only shown to roles allowed to view
+	// ID documents
+	var showIDButton *widget.Button
+	showIDButton = widget.NewButton("Show Full ID Number", func() {
+		if !requirePermission(window, permViewIDDocuments) {
+			return
+		}
+		detailsLabel.SetText(profileDetails(customer.GovIDNumber))
+		showIDButton.Hide()
+	})
+	showPhotoButton := widget.NewButton("View ID Photo", func() {
+		if !requirePermission(window, permViewIDDocuments) {
+			return
+		}
+		showIDPhotoWindow(myApp, customer)
+	})
+	if !can(permViewIDDocuments) {
+		showIDButton.Hide()
+		showPhotoButton.Hide()
+	}
+	if customer.GovIDPhotoPath == "" {
+		showPhotoButton.Disable()
+	}
+
+	bills := billDB.billsForCustomer(customer.ID)
+	summaryLabel := widget.NewLabel(buildCustomerHistory(bills).summary())
+
+	historyList := widget.NewList(
+		func() int { return len(bills) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(billHistoryLine(bills[i]))
+		},
+	)
+	selected := -1
+	historyList.OnSelected = func(i widget.ListItemID) {
+		selected = i
+	}
+
+	notesEntry := widget.NewMultiLineEntry()
+	notesEntry.SetPlaceHolder("Notes (preferences, special requests...)")
+	notesEntry.SetText(customer.Notes)
+
+	statusLabel := widget.NewLabel("")
+
+	saveNotesButton := widget.NewButton("Save Notes", func() {
+		if !requirePermission(window, permAddCustomers) {
+			return
+		}
+		if err := db.updateCustomerNotes(customer.ID, notesEntry.Text); err != nil {
+			statusLabel.SetText("Error saving notes: " + err.Error())
+			return
+		}
+		customer.Notes = notesEntry.Text
+		statusLabel.SetText("Notes saved successfully!")
+	})
+
+	// Rebills the selected stay, or the latest one if none is selected
+	rebillButton := widget.NewButton("Rebill Similar Stay", func() {
+		if !requirePermission(window, permCreateBills) {
+			return
+		}
+		if len(bills) == 0 {
+			statusLabel.SetText("This customer has no previous stays")
+			return
+		}
+		bill := bills[0]
+		if selected >= 0 {
+			bill = bills[selected]
+		}
+		bill.Customer = customer
+		showCreateBillWindow(myApp, db, billDB, companyDB, &bill)
+	})
+	regCardButton := widget.NewButton("Registration Card", func() {
+		if !requirePermission(window, permCreateBills) {
+			return
+		}
+		if len(bills) == 0 {
+			statusLabel.SetText("This customer has no previous stays")
+			return
+		}
+		bill := bills[0]
+		if selected >= 0 {
+			bill = bills[selected]
+		}
+		path, err := generateRegistrationCard(bill)
+		if err != nil {
+			statusLabel.SetText("Error generating registration card: " + err.Error())
+			return
+		}
+		statusLabel.SetText("Registration card saved to " + path)
+	})
+	// Prints the stored bill again; the bill itself cannot be changed here
+	reprintButton := widget.NewButton("Reprint Invoice", func() {
+		if !requirePermission(window, permCreateBills) {
+			return
+		}
+		if selected < 0 {
+			statusLabel.SetText("Please select a bill to reprint")
+			return
+		}
+		bill := bills[selected]
+		if err := generatePDF(bill); err != nil {
+			statusLabel.SetText("Error generating PDF: " + err.Error())
+			return
+		}
+		statusLabel.SetText("Invoice saved to " + invoicePath(bill.BillNumber))
+	})
+	paymentButton := widget.NewButton("Record Payment", func() {
+		if !requirePermission(window, permRecordPayments) {
+			return
+		}
+		if selected < 0 {
+			statusLabel.SetText("Please select a bill to record a payment on")
+			return
+		}
+		bill := bills[selected]
+		amountEntry := widget.NewEntry()
+		amountEntry.SetText(fmt.Sprintf("%.2f", bill.balance()))
+		modeSelect := widget.NewSelect(paymentModes, nil)
+		modeSelect.SetSelectedIndex(0)
+		dialog.ShowForm(fmt.Sprintf("Payment on Bill %s (due ₹%.2f)", bill.BillNumber, bill.balance()), "Record", "Cancel",
+			[]*widget.FormItem{
+				widget.NewFormItem("Amount", amountEntry),
+				widget.NewFormItem("Mode", modeSelect),
+			},
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				amount, err := strconv.ParseFloat(strings.TrimSpace(amountEntry.Text), 64)
+				if err != nil {
+					statusLabel.SetText("Please enter a valid amount")
+					return
+				}
+				if err := billDB.recordPayment(bill.BillNumber, modeSelect.Selected, amount); err != nil {
+					statusLabel.SetText("Error recording payment: " + err.Error())
+					return
+				}
+				bills = billDB.billsForCustomer(customer.ID)
+				historyList.Refresh()
+				summaryLabel.SetText(buildCustomerHistory(bills).summary())
+				// Reprint the invoice so that it shows the amount paid
+				updated, _ := billDB.getBill(bill.BillNumber)
+				if err := generatePDF(updated); err != nil {
+					statusLabel.SetText("Payment recorded but PDF could not be regenerated: " + err.Error())
+					return
+				}
+				statusLabel.SetText(fmt.Sprintf("Payment of ₹%.2f recorded on bill %s", amount, bill.BillNumber))
+			}, window)
+	})
+	cancelButton := widget.NewButton("Cancel Selected Bill", func() {
+		if !requirePermission(window, permCancelBills) {
+			return
+		}
+		if selected < 0 {
+			statusLabel.SetText("Please select a bill to cancel")
+			return
+		}
+		bill := bills[selected]
+		reasonEntry := widget.NewEntry()
+		dialog.ShowForm("Cancel Bill "+bill.BillNumber, "Cancel Bill", "Keep Bill",
+			[]*widget.FormItem{widget.NewFormItem("Reason", reasonEntry)},
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := billDB.cancelBill(bill.BillNumber, reasonEntry.Text); err != nil {
+					statusLabel.SetText("Error cancelling bill: " + err.Error())
+					return
+				}
+				bills = billDB.billsForCustomer(customer.ID)
+				historyList.Refresh()
+				statusLabel.SetText("Bill " + bill.BillNumber + " cancelled")
+			}, window)
+	})
+
+	if len(bills) == 0 {
+		rebillButton.Disable()
+		regCardButton.Disable()
+		reprintButton.Disable()
+		paymentButton.Disable()
+		cancelButton.Disable()
+	}
+	if !can(permCreateBills) {
+		rebillButton.Hide()
+		regCardButton.Hide()
+		reprintButton.Hide()
+	}
+	if !can(permRecordPayments) {
+		paymentButton.Hide()
+	}
+	if !can(permCancelBills) {
+		cancelButton.Hide()
+	}
+
+	top := container.NewVBox(
+		detailsLabel,
+		container.NewHBox(showIDButton, showPhotoButton),
+		summaryLabel,
+		widget.NewLabel("Stay History:"),
+	)
+	bottom := container.NewVBox(
+		container.NewGridWithColumns(3, rebillButton, regCardButton, reprintButton, paymentButton, cancelButton),
+		widget.NewLabel("Notes:"),
+		notesEntry,
+		saveNotesButton,
+		statusLabel,
+	)
+
+	window.SetContent(container.NewPadded(container.NewBorder(top, bottom, nil, nil, historyList)))
+	window.Resize(fyne.NewSize(600, 700))
+	window.Show()
+}
+
+// showIDPhotoWindow displays a customer's ID photo, decrypting it if the
+// data directory is encrypted
+func showIDPhotoWindow(myApp fyne.App, customer Customer) {
+	window := myApp.NewWindow("ID Photo - " + customer.Name)
+
+	data, err := readDataFile(customer.GovIDPhotoPath)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("failed to read ID photo: %v", err), window)
+		window.Show()
+		return
+	}
+
+	image := canvas.NewImageFromResource(fyne.NewStaticResource(filepath.Base(customer.GovIDPhotoPath), data))
+	image.FillMode = canvas.ImageFillContain
+
+	window.SetContent(image)
+	window.Resize(fyne.NewSize(600, 450))
+	window.Show()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+const pickerResultLimit = 8
+
+// customerIndex supports partial-match search over customer ID, name, phone
+// and ID number. Each customer's fields are normalised into one search key
+// and every three-letter substring of the keys is indexed, so a query only
+// has to be checked against the customers sharing all of its trigrams.
+type customerIndex struct {
+	keys     []string
+	names    []string
+	trigrams map[string][]int
+}
+
+// normalizeSearch lower-cases text and drops spaces and punctuation so that
+// "98765 43210" matches "9876543210" and "ab-12" matches "AB12"
+func normalizeSearch(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func buildCustomerIndex(customers []Customer) *customerIndex {
+	idx := &customerIndex{trigrams: map[string][]int{}}
+	for i, c := range customers {
+		// Fields are kept apart by a separator that queries never contain
+		key := strings.Join([]string{
+			normalizeSearch(c.ID), normalizeSearch(c.Name),
+			normalizeSearch(c.Phone), normalizeSearch(c.GovIDNumber),
+		}, "|")
+		idx.keys = append(idx.keys, key)
+		idx.names = append(idx.names, normalizeSearch(c.Name))
+
+		seen := map[string]bool{}
+		for j := 0; j+3 <= len(key); j++ {
+			t := key[j : j+3]
+			if !seen[t] && !strings.Contains(t, "|") {
+				seen[t] = true
+				idx.trigrams[t] = append(idx.trigrams[t], i)
+			}
+		}
+	}
+	return idx
+}
+
+// candidates returns the customers whose keys contain every trigram of
+// word, or nil and false when word is too short to use the index
+func (idx *customerIndex) candidates(word string) ([]int, bool) {
+	if len(word) < 3 {
+		return nil, false
+	}
+	var result []int
+	for j := 0; j+3 <= len(word); j++ {
+		postings := idx.trigrams[word[j:j+3]]
+		if j == 0 {
+			result = append([]int{}, postings...)
+			continue
+		}
+		// Postings are in customer order, so intersect by merging
+		var merged []int
+		a, b := 0, 0
+		for a < len(result) && b < len(postings) {
+			switch {
+			case result[a] == postings[b]:
+				merged = append(merged, result[a])
+				a++
+				b++
+			case result[a] < postings[b]:
+				a++
+			default:
+				b++
+			}
+		}
+		result = merged
+	}
+	return result, true
+}
+
+// search returns the positions of the customers matching every word of the
+// query, best matches first: exact customer ID, then names starting with
+// the query, then any other partial match
+func (idx *customerIndex) search(query string) []int {
+	var words []string
+	for _, w := range strings.Fields(query) {
+		if w = normalizeSearch(w); w != "" {
+			words = append(words, w)
+		}
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	// Use the longest word to narrow the customers down
+	longest := words[0]
+	for _, w := range words {
+		if len(w) > len(longest) {
+			longest = w
+		}
+	}
+	pool, ok := idx.candidates(longest)
+	if !ok {
+		pool = make([]int, len(idx.keys))
+		for i := range pool {
+			pool[i] = i
+		}
+	}
+
+	var matches []int
+	for _, i := range pool {
+		all := true
+		for _, w := range words {
+			if !strings.Contains(idx.keys[i], w) {
+				all = false
+				break
+			}
+		}
+		if all {
+			matches = append(matches, i)
+		}
+	}
+
+	whole := normalizeSearch(query)
+	rank := func(i int) int {
+		switch {
+		case strings.HasPrefix(idx.keys[i], whole+"|"):
+			return 0
+		case strings.HasPrefix(idx.names[i], whole):
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		return rank(matches[a]) < rank(matches[b])
+	})
+	return matches
+}
+
+// searchCustomers finds customers by partial name, phone, customer ID or
+// government ID number. A limit of 0 returns every match.
+func (db *CustomerDB) searchCustomers(query string, limit int) []Customer {
+	if db.index == nil {
+		db.index = buildCustomerIndex(db.customers)
+	}
+	var result []Customer
+	for _, i := range db.index.search(query) {
+		if limit > 0 && len(result) == limit {
+			break
+		}
+		result = append(result, db.customers[i])
+	}
+	return result
+}
+
+func customerLabel(c Customer) string {
+	return fmt.Sprintf("%s - %s (%s)", c.ID, c.Name, c.Phone)
+}
+
+// customerPicker is a type-ahead search box that selects a customer by ID
+type customerPicker struct {
+	db       *CustomerDB
+	onSelect func(Customer)
+
+	entry    *widget.Entry
+	results  *fyne.Container
+	selected *widget.Label
+	content  fyne.CanvasObject
+}
+
+func newCustomerPicker(db *CustomerDB, onSelect func(Customer)) *customerPicker {
+	p := &customerPicker{db: db, onSelect: onSelect}
+
+	p.entry = widget.NewEntry()
+	p.entry.SetPlaceHolder("Search by name, phone, customer ID or ID number")
+	p.entry.OnChanged = p.update
+	p.results = container.NewVBox()
+	p.selected = widget.NewLabel("No customer selected")
+
+	p.content = container.NewVBox(p.entry, p.results, p.selected)
+	return p
+}
+
+func (p *customerPicker) update(query string) {
+	p.results.Objects = nil
+	matches := p.db.searchCustomers(query, pickerResultLimit+1)
+	for i, c := range matches {
+		if i == pickerResultLimit {
+			p.results.Add(widget.NewLabel("More customers match, keep typing..."))
+			break
+		}
+		id := c.ID
+		p.results.Add(widget.NewButton(customerLabel(c), func() {
+			p.selectID(id)
+		}))
+	}
+	if query != "" && len(matches) == 0 {
+		p.results.Add(widget.NewLabel("No matching customers"))
+	}
+	p.results.Refresh()
+}
+
+// selectID selects the customer with the given ID, as if picked from the results
+func (p *customerPicker) selectID(id string) bool {
+	c, ok := p.db.getCustomer(id)
+	if !ok {
+		return false
+	}
+	p.entry.OnChanged = nil
+	p.entry.SetText("")
+	p.entry.OnChanged = p.update
+	p.update("")
+	p.selected.SetText("Selected: " + customerLabel(c))
+	p.onSelect(c)
+	return true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// The desktop app, the API server and command-line runs may all change the
+// data files at the same time. Every change takes the data lock, reloads
+// the file it changes, applies the change and saves it, so that records
+// saved by another process in the meantime are kept and IDs and audit log
+// sequence numbers are given out once.
+const dataLockPath = "customer_data/.lock"
+
+// dataMu serializes changes within the process; the lock file serializes
+// them between processes
+var dataMu sync.Mutex
+
+// withDataLock runs fn holding the data lock. It is not reentrant: fn must
+// not call methods that take the lock themselves.
+func withDataLock(fn func() error) error {
+	dataMu.Lock()
+	defer dataMu.Unlock()
+
+	if err := os.MkdirAll("customer_data", 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dataLockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open data lock: %v", err)
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("cannot lock data files: %v", err)
+	}
+	defer unlockFile(f)
+	return fn()
+}
+
+// writeFileAtomic replaces a file through a temporary file, so that other
+// processes reading it without the lock never see it half written
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentAddsKeepEveryRecord(t *testing.T) {
+	inTempDir(t)
+	// two databases loaded before either adds anything, as the desktop app
+	// and the API server would be
+	dbs := []*CustomerDB{NewCustomerDB(), NewCustomerDB()}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := Customer{Name: fmt.Sprintf("Guest %d", i)}
+			errs <- dbs[i%2].addCustomer(&c)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := map[string]bool{}
+	for _, c := range NewCustomerDB().getCustomers() {
+		ids[c.ID] = true
+	}
+	if len(ids) != 20 {
+		t.Fatalf("%d distinct customers saved, want 20", len(ids))
+	}
+	if n, _, err := verifyAuditLog(); err != nil || n != 20 {
+		t.Fatalf("audit log has %d entries (%v), want 20", n, err)
+	}
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// EInvoiceDetails holds what the IRP returns after registering an invoice
+type EInvoiceDetails struct {
+	Irn          string `json:"irn"`
+	AckNo        int64  `json:"ack_no"`
+	AckDt        string `json:"ack_dt"`
+	SignedQRCode string `json:"signed_qr_code"`
+}
+
+// eInvoice follows the NIC e-invoice schema version 1.1
+type eInvoice struct {
+	Version    string             `json:"Version"`
+	TranDtls   eInvoiceTran       `json:"TranDtls"`
+	DocDtls    eInvoiceDoc        `json:"DocDtls"`
+	SellerDtls eInvoiceParty      `json:"SellerDtls"`
+	BuyerDtls  eInvoiceParty      `json:"BuyerDtls"`
+	ItemList   []eInvoiceItem     `json:"ItemList"`
+	ValDtls    eInvoiceValDetails `json:"ValDtls"`
+}
+
+type eInvoiceTran struct {
+	TaxSch      string `json:"TaxSch"`
+	SupTyp      string `json:"SupTyp"`
+	RegRev      string `json:"RegRev"`
+	IgstOnIntra string `json:"IgstOnIntra"`
+}
+
+type eInvoiceDoc struct {
+	Typ string `json:"Typ"`
+	No  string `json:"No"`
+	Dt  string `json:"Dt"`
+}
+
+type eInvoiceParty struct {
+	Gstin string `json:"Gstin"`
+	LglNm string `json:"LglNm"`
+	Pos   string `json:"Pos,omitempty"`
+	Addr1 string `json:"Addr1"`
+	Loc   string `json:"Loc"`
+	Pin   int    `json:"Pin"`
+	Stcd  string `json:"Stcd"`
+	Ph    string `json:"Ph,omitempty"`
+}
+
+type eInvoiceItem struct {
+	SlNo       string  `json:"SlNo"`
+	PrdDesc    string  `json:"PrdDesc"`
+	IsServc    string  `json:"IsServc"`
+	HsnCd      string  `json:"HsnCd"`
+	Qty        float64 `json:"Qty"`
+	Unit       string  `json:"Unit"`
+	UnitPrice  float64 `json:"UnitPrice"`
+	TotAmt     float64 `json:"TotAmt"`
+	AssAmt     float64 `json:"AssAmt"`
+	GstRt      float64 `json:"GstRt"`
+	IgstAmt    float64 `json:"IgstAmt"`
+	CgstAmt    float64 `json:"CgstAmt"`
+	SgstAmt    float64 `json:"SgstAmt"`
+	TotItemVal float64 `json:"TotItemVal"`
+}
+
+type eInvoiceValDetails struct {
+	AssVal    float64 `json:"AssVal"`
+	CgstVal   float64 `json:"CgstVal"`
+	SgstVal   float64 `json:"SgstVal"`
+	IgstVal   float64 `json:"IgstVal"`
+	TotInvVal float64 `json:"TotInvVal"`
+}
+
+// irpResponse is the subset of the IRP "generate IRN" response we keep
+type irpResponse struct {
+	AckNo         int64  `json:"AckNo"`
+	AckDt         string `json:"AckDt"`
+	Irn           string `json:"Irn"`
+	SignedInvoice string `json:"SignedInvoice"`
+	SignedQRCode  string `json:"SignedQRCode"`
+}
+
+var (
+	eInvoiceDocNoPattern = regexp.MustCompile(`^[A-Za-z1-9][A-Za-z0-9/-]{0,15}$`)
+	eInvoiceHsnPattern   = regexp.MustCompile(`^[0-9]{4,8}$`)
+	pinPattern           = regexp.MustCompile(`\b[1-9][0-9]{5}\b`)
+	eInvoiceGSTRates     = []float64{0, 0.1, 0.25, 1, 1.5, 3, 5, 6, 7.5, 12, 18, 28}
+)
+
+// buildEInvoice converts a stored B2B bill into the NIC e-invoice payload
+func buildEInvoice(bill Bill) (eInvoice, error) {
+	if bill.BillTo == nil || bill.GuestGSTIN == "" {
+		return eInvoice{}, fmt.Errorf("bill %s is not a B2B invoice", bill.BillNumber)
+	}
+
+	a := bill.amounts()
+	inv := eInvoice{
+		Version: "1.1",
+		TranDtls: eInvoiceTran{
+			TaxSch:      "GST",
+			SupTyp:      "B2B",
+			RegRev:      "N",
+			IgstOnIntra: "N",
+		},
+		DocDtls: eInvoiceDoc{
+			Typ: "INV",
+			No:  bill.BillNumber,
+			Dt:  bill.Date.Format("02/01/2006"),
+		},
+		SellerDtls: eInvoiceParty{
+			Gstin: sellerGSTIN,
+			LglNm: sellerName,
+			Addr1: sellerAddress,
+			Loc:   sellerLocation,
+			Pin:   sellerPin,
+			Stcd:  sellerStateCode,
+			Ph:    sellerPhone,
+		},
+		BuyerDtls: eInvoiceParty{
+			Gstin: bill.BillTo.GSTIN,
+			LglNm: bill.BillTo.LegalName,
+			Pos:   bill.PlaceOfSupply,
+			Addr1: strings.Join(strings.Fields(bill.BillTo.Address), " "),
+			Loc:   gstStates[bill.BillTo.StateCode],
+			Stcd:  bill.BillTo.StateCode,
+		},
+		ValDtls: eInvoiceValDetails{
+			AssVal:    a.Taxable,
+			CgstVal:   a.CGST,
+			SgstVal:   a.SGST,
+			IgstVal:   a.IGST,
+			TotInvVal: a.Total,
+		},
+	}
+	if pin := pinPattern.FindString(bill.BillTo.Address); pin != "" {
+		fmt.Sscanf(pin, "%d", &inv.BuyerDtls.Pin)
+	}
+
+	for i, item := range bill.Items {
+		line := taxSplit(item.Rate*float64(item.Days), bill.isInterState())
+		inv.ItemList = append(inv.ItemList, eInvoiceItem{
+			SlNo:       fmt.Sprintf("%d", i+1),
+			PrdDesc:    item.Description,
+			IsServc:    "Y",
+			HsnCd:      sacAccommodation,
+			Qty:        float64(item.Days),
+			Unit:       "OTH",
+			UnitPrice:  item.Rate,
+			TotAmt:     line.Taxable,
+			AssAmt:     line.Taxable,
+			GstRt:      gstRate,
+			IgstAmt:    line.IGST,
+			CgstAmt:    line.CGST,
+			SgstAmt:    line.SGST,
+			TotItemVal: line.Total,
+		})
+	}
+
+	return inv, nil
+}
+
+// validateEInvoice checks the payload against the constraints of the NIC
+// schema so that obvious rejections are caught before upload.
+func validateEInvoice(inv eInvoice) []string {
+	var errs []string
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if inv.Version != "1.1" {
+		add("Version must be 1.1")
+	}
+	if inv.DocDtls.Typ != "INV" && inv.DocDtls.Typ != "CRN" && inv.DocDtls.Typ != "DBN" {
+		add("DocDtls.Typ must be INV, CRN or DBN")
+	}
+	if !eInvoiceDocNoPattern.MatchString(inv.DocDtls.No) {
+		add("DocDtls.No %q must be 1-16 characters of letters, digits, / or - and not start with 0, / or -", inv.DocDtls.No)
+	}
+	if dt, err := time.Parse("02/01/2006", inv.DocDtls.Dt); err != nil {
+		add("DocDtls.Dt %q must be in dd/mm/yyyy format", inv.DocDtls.Dt)
+	} else if dt.After(time.Now()) {
+		add("DocDtls.Dt cannot be a future date")
+	}
+
+	checkParty := func(name string, p eInvoiceParty) {
+		if !gstinPattern.MatchString(p.Gstin) {
+			add("%s.Gstin %q is not a valid GSTIN", name, p.Gstin)
+		}
+		if l := len(p.LglNm); l < 1 || l > 100 {
+			add("%s.LglNm must be 1-100 characters", name)
+		}
+		if l := len(p.Addr1); l < 1 || l > 100 {
+			add("%s.Addr1 must be 1-100 characters", name)
+		}
+		if l := len(p.Loc); l < 3 || l > 50 {
+			add("%s.Loc must be 3-50 characters", name)
+		}
+		if p.Pin < 100000 || p.Pin > 999999 {
+			add("%s.Pin must be a 6-digit PIN code", name)
+		}
+		if _, ok := gstStates[p.Stcd]; !ok {
+			add("%s.Stcd %q is not a valid state code", name, p.Stcd)
+		}
+	}
+	checkParty("SellerDtls", inv.SellerDtls)
+	checkParty("BuyerDtls", inv.BuyerDtls)
+	// The seller is the taxpayer logged in to the IRP, so only the buyer
+	// GSTIN is verified against its check digit here.
+	if err := validateGSTIN(inv.BuyerDtls.Gstin); err != nil {
+		add("BuyerDtls.Gstin: %v", err)
+	}
+	if _, ok := gstStates[inv.BuyerDtls.Pos]; !ok {
+		add("BuyerDtls.Pos %q is not a valid state code", inv.BuyerDtls.Pos)
+	}
+	if inv.SellerDtls.Gstin == inv.BuyerDtls.Gstin {
+		add("BuyerDtls.Gstin cannot be the same as SellerDtls.Gstin")
+	}
+
+	if len(inv.ItemList) == 0 || len(inv.ItemList) > 1000 {
+		add("ItemList must contain 1-1000 items")
+	}
+	var assVal, totVal float64
+	for _, item := range inv.ItemList {
+		prefix := "ItemList[" + item.SlNo + "]"
+		if !eInvoiceHsnPattern.MatchString(item.HsnCd) {
+			add("%s.HsnCd must be 4-8 digits", prefix)
+		}
+		if item.IsServc != "Y" && item.IsServc != "N" {
+			add("%s.IsServc must be Y or N", prefix)
+		}
+		validRate := false
+		for _, rt := range eInvoiceGSTRates {
+			if item.GstRt == rt {
+				validRate = true
+			}
+		}
+		if !validRate {
+			add("%s.GstRt %.2f is not a valid GST rate", prefix, item.GstRt)
+		}
+		if round2(item.AssAmt+item.IgstAmt+item.CgstAmt+item.SgstAmt) != item.TotItemVal {
+			add("%s.TotItemVal does not match the assessable value plus taxes", prefix)
+		}
+		assVal += item.AssAmt
+		totVal += item.TotItemVal
+	}
+	if round2(assVal) != inv.ValDtls.AssVal {
+		add("ValDtls.AssVal does not match the sum of item assessable values")
+	}
+	if round2(totVal) != inv.ValDtls.TotInvVal {
+		add("ValDtls.TotInvVal does not match the sum of item values")
+	}
+
+	return errs
+}
+
+// exportEInvoiceJSON validates the payload for a bill and writes it to
+// EInvoice/<bill number>.json for upload to the IRP.
+func exportEInvoiceJSON(bill Bill) (string, []string, error) {
+	inv, err := buildEInvoice(bill)
+	if err != nil {
+		return "", nil, err
+	}
+	if errs := validateEInvoice(inv); len(errs) > 0 {
+		return "", errs, nil
+	}
+
+	if err := os.MkdirAll("EInvoice", 0755); err != nil {
+		return "", nil, fmt.Errorf("failed to create EInvoice directory: %v", err)
+	}
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return "", nil, err
+	}
+	filename := filepath.Join("EInvoice", fmt.Sprintf("EInvoice_%s.json", strings.ReplaceAll(bill.BillNumber, "/", "_")))
+	return filename, nil, ioutil.WriteFile(filename, data, 0644)
+}
+
+// qrClaims decodes the payload of a signed QR code without verifying it
+func qrClaims(signedQR string) (map[string]interface{}, error) {
+	parts := strings.Split(signedQR, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("signed QR code is not a JWT")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signed QR code payload: %v", err)
+	}
+	var claims struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, fmt.Errorf("invalid signed QR code payload: %v", err)
+	}
+	// The IRP sends the data claim as a JSON string; accept an object too.
+	var inner string
+	if err := json.Unmarshal(claims.Data, &inner); err == nil {
+		claims.Data = json.RawMessage(inner)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(claims.Data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid signed QR code payload: %v", err)
+	}
+	return fields, nil
+}
+
+// errIRNExists is returned when importing a response for a bill that has
+// already been e-invoiced and replace was not asked for
+var errIRNExists = errors.New("bill already has an IRN")
+
+// importIRPResponse attaches an IRP response to the stored bill after
+// checking that the IRN and QR code belong to it. An IRN already on the bill
+// is only overwritten with replace, and cancelled bills are refused.
+func importIRPResponse(billDB *BillDB, billNumber string, data []byte, replace bool) (Bill, error) {
+	var resp irpResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return Bill{}, fmt.Errorf("invalid IRP response: %v", err)
+	}
+	// Some portals wrap the result in {"Status":1,"Data":{...}}
+	if resp.Irn == "" {
+		var wrapped struct {
+			Data json.RawMessage `json:"Data"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err == nil && len(wrapped.Data) > 0 {
+			json.Unmarshal(wrapped.Data, &resp)
+		}
+	}
+
+	if len(resp.Irn) != 64 {
+		return Bill{}, fmt.Errorf("IRN must be 64 characters, got %d", len(resp.Irn))
+	}
+	if _, err := hex.DecodeString(resp.Irn); err != nil {
+		return Bill{}, fmt.Errorf("IRN is not a hexadecimal hash")
+	}
+
+	claims, err := qrClaims(resp.SignedQRCode)
+	if err != nil {
+		return Bill{}, err
+	}
+	if claims["DocNo"] != billNumber {
+		return Bill{}, fmt.Errorf("QR code is for document %v, not bill %s", claims["DocNo"], billNumber)
+	}
+	if claims["Irn"] != resp.Irn {
+		return Bill{}, fmt.Errorf("QR code IRN does not match the response IRN")
+	}
+
+	var updated Bill
+	err = billDB.updateBill(billNumber, func(bill *Bill) error {
+		if bill.cancelled() {
+			return fmt.Errorf("bill %s is cancelled", billNumber)
+		}
+		if bill.EInvoice != nil && !replace {
+			return errIRNExists
+		}
+		bill.EInvoice = &EInvoiceDetails{
+			Irn:          resp.Irn,
+			AckNo:        resp.AckNo,
+			AckDt:        resp.AckDt,
+			SignedQRCode: resp.SignedQRCode,
+		}
+		updated = *bill
+		return nil
+	})
+	return updated, err
+}
+
+func showEInvoiceWindow(myApp fyne.App, billDB *BillDB) {
+	window := myApp.NewWindow("E-Invoice")
+
+	var b2bBills []Bill
+	for _, bill := range billDB.getBills() {
+		if bill.BillTo != nil && !bill.cancelled() {
+			b2bBills = append(b2bBills, bill)
+		}
+	}
+	if len(b2bBills) == 0 {
+		dialog.ShowInformation("No B2B Bills", "Only bills raised on a company can be e-invoiced", window)
+		return
+	}
+
+	billOptions := make([]string, len(b2bBills))
+	for i, bill := range b2bBills {
+		billOptions[i] = fmt.Sprintf("%s - %s (%s)", bill.BillNumber, bill.BillTo.LegalName, bill.Date.Format("02-01-2006"))
+	}
+	billSelect := widget.NewSelect(billOptions, nil)
+
+	errorsGrid := widget.NewTextGrid()
+	statusLabel := widget.NewLabel("")
+
+	selectedBill := func() (Bill, bool) {
+		i := billSelect.SelectedIndex()
+		if i < 0 {
+			statusLabel.SetText("Please select a bill")
+			return Bill{}, false
+		}
+		return b2bBills[i], true
+	}
+
+	// Reprint the invoice so that it carries the IRN and QR code
+	attach := func(bill Bill) {
+		for i := range b2bBills {
+			if b2bBills[i].BillNumber == bill.BillNumber {
+				b2bBills[i] = bill
+			}
+		}
+		if err := generatePDF(bill); err != nil {
+			statusLabel.SetText("IRN saved but PDF could not be regenerated: " + err.Error())
+			return
+		}
+		statusLabel.SetText("IRN " + bill.EInvoice.Irn[:16] + "... added to invoice " + bill.BillNumber)
+	}
+
+	exportButton := widget.NewButton("Generate E-Invoice JSON", func() {
+		bill, ok := selectedBill()
+		if !ok {
+			return
+		}
+		filename, errs, err := exportEInvoiceJSON(bill)
+		if err != nil {
+			statusLabel.SetText("Error generating e-invoice: " + err.Error())
+			return
+		}
+		if len(errs) > 0 {
+			errorsGrid.SetText("Schema validation failed:\n" + strings.Join(errs, "\n"))
+			statusLabel.SetText("E-invoice JSON not written")
+			return
+		}
+		errorsGrid.SetText("")
+		statusLabel.SetText("E-invoice JSON written to " + filename)
+	})
+
+	importButton := widget.NewButton("Import IRP Response", func() {
+		bill, ok := selectedBill()
+		if !ok {
+			return
+		}
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			importResponse := func(replace bool) {
+				updated, err := importIRPResponse(billDB, bill.BillNumber, data, replace)
+				if err != nil {
+					statusLabel.SetText("Error importing IRP response: " + err.Error())
+					return
+				}
+				attach(updated)
+			}
+			if bill.EInvoice == nil {
+				importResponse(false)
+				return
+			}
+			dialog.ShowConfirm("Replace IRN",
+				fmt.Sprintf("Bill %s already has IRN %s. Replace it with the imported one?", bill.BillNumber, bill.EInvoice.Irn),
+				func(ok bool) {
+					if ok {
+						importResponse(true)
+					}
+				}, window)
+		}, window)
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("Select B2B Bill:"),
+		billSelect,
+		exportButton,
+		importButton,
+		statusLabel,
+		errorsGrid,
+	)
+
+	window.SetContent(container.NewPadded(content))
+	window.Resize(fyne.NewSize(500, 400))
+	window.Show()
+}
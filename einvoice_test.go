@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// localIRPStub imitates the IRP: it computes the IRN the same way the
+// portal does and signs the QR payload with a test key.
+type localIRPStub struct {
+	key   []byte
+	ackNo int64
+}
+
+func newLocalIRPStub() *localIRPStub {
+	return &localIRPStub{key: []byte("local-irp-stub"), ackNo: 112610000000000}
+}
+
+func (s *localIRPStub) GenerateIRN(inv eInvoice) (irpResponse, error) {
+	if errs := validateEInvoice(inv); len(errs) > 0 {
+		return irpResponse{}, fmt.Errorf("invoice rejected: %s", strings.Join(errs, "; "))
+	}
+	docDate, _ := time.Parse("02/01/2006", inv.DocDtls.Dt)
+
+	irn := computeIRN(inv.SellerDtls.Gstin, financialYear(docDate), inv.DocDtls.Typ, inv.DocDtls.No)
+	now := time.Now()
+	s.ackNo++
+
+	qrPayload, err := json.Marshal(map[string]interface{}{
+		"SellerGstin": inv.SellerDtls.Gstin,
+		"BuyerGstin":  inv.BuyerDtls.Gstin,
+		"DocNo":       inv.DocDtls.No,
+		"DocTyp":      inv.DocDtls.Typ,
+		"DocDt":       inv.DocDtls.Dt,
+		"TotInvVal":   inv.ValDtls.TotInvVal,
+		"ItemCnt":     len(inv.ItemList),
+		"MainHsnCode": inv.ItemList[0].HsnCd,
+		"Irn":         irn,
+		"IrnDt":       now.Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		return irpResponse{}, err
+	}
+	// Like the IRP, the data claim is a JSON string
+	signedQR, err := s.sign(map[string]interface{}{"data": string(qrPayload)})
+	if err != nil {
+		return irpResponse{}, err
+	}
+	signedInvoice, err := s.sign(map[string]interface{}{"data": inv})
+	if err != nil {
+		return irpResponse{}, err
+	}
+
+	return irpResponse{
+		AckNo:         s.ackNo,
+		AckDt:         now.Format("2006-01-02 15:04:05"),
+		Irn:           irn,
+		SignedInvoice: signedInvoice,
+		SignedQRCode:  signedQR,
+	}, nil
+}
+
+// sign produces a JWS compact token, HMAC signed instead of the IRP's RSA key
+func (s *localIRPStub) sign(claims interface{}) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// computeIRN hashes the supplier GSTIN, financial year, document type and
+// document number as specified for the Invoice Reference Number.
+func computeIRN(gstin, fy, docType, docNo string) string {
+	sum := sha256.Sum256([]byte(gstin + fy + docType + docNo))
+	return hex.EncodeToString(sum[:])
+}
+
+// financialYear returns the Indian financial year, e.g. "2026-27"
+func financialYear(t time.Time) string {
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+func testB2BBill(number string) Bill {
+	body := "29AABCU9603R1Z"
+	company := Company{
+		ID:        "COMP1",
+		LegalName: "Acme Travels Pvt Ltd",
+		GSTIN:     body + string(gstinCheckDigit(body)),
+		Address:   "4 MG Road, Bengaluru 560001",
+		StateCode: "29",
+	}
+	from := time.Date(2026, 5, 4, 0, 0, 0, 0, time.Local)
+	return Bill{
+		BillNumber:    number,
+		Customer:      Customer{ID: "CUST1", Name: "Ravi Kumar", Phone: "9876543210"},
+		BillTo:        &company,
+		GuestGSTIN:    company.GSTIN,
+		PlaceOfSupply: sellerStateCode,
+		Adults:        1,
+		Items: []RentalItem{{
+			Description: "AC Room",
+			Rate:        2500,
+			Days:        2,
+			FromDate:    from,
+			ToDate:      from.AddDate(0, 0, 1),
+		}},
+		Date: from,
+	}
+}
+
+func TestImportIRPResponse(t *testing.T) {
+	inTempDir(t)
+	billDB := NewBillDB()
+	for _, number := range []string{"INV/1", "INV/2"} {
+		bill := testB2BBill(number)
+		if err := billDB.addBill(&bill); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stub := newLocalIRPStub()
+	respond := func(number string) []byte {
+		inv, err := buildEInvoice(testB2BBill(number))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := stub.GenerateIRN(inv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(resp)
+		return data
+	}
+
+	if _, err := importIRPResponse(billDB, "INV/1", respond("INV/2"), false); err == nil {
+		t.Error("response for another bill was accepted")
+	}
+	if _, err := importIRPResponse(billDB, "INV/1", []byte(`{"Irn":"abc"}`), false); err == nil {
+		t.Error("response with a short IRN was accepted")
+	}
+
+	data := respond("INV/1")
+	wrapped := []byte(`{"Status":1,"Data":` + string(data) + `}`)
+	updated, err := importIRPResponse(billDB, "INV/1", wrapped, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := computeIRN(sellerGSTIN, "2026-27", "INV", "INV/1")
+	if updated.EInvoice == nil || updated.EInvoice.Irn != want {
+		t.Fatalf("IRN not attached: %+v", updated.EInvoice)
+	}
+	stored, _ := NewBillDB().getBill("INV/1")
+	if stored.EInvoice == nil || stored.EInvoice.Irn != want {
+		t.Errorf("IRN not saved: %+v", stored.EInvoice)
+	}
+	if other, _ := NewBillDB().getBill("INV/2"); other.EInvoice != nil {
+		t.Errorf("IRN attached to the wrong bill")
+	}
+
+	if _, err := importIRPResponse(billDB, "INV/1", data, false); !errors.Is(err, errIRNExists) {
+		t.Errorf("second import = %v, want errIRNExists", err)
+	}
+	if _, err := importIRPResponse(billDB, "INV/1", data, true); err != nil {
+		t.Errorf("replacing the IRN: %v", err)
+	}
+
+	if err := billDB.cancelBill("INV/2", "duplicate"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importIRPResponse(billDB, "INV/2", respond("INV/2"), true); err == nil {
+		t.Error("IRN attached to a cancelled bill")
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Customer and bill data and ID photos can be encrypted at rest with
+// AES-256-GCM. The key is derived from an admin passphrase with scrypt, or
+// read from a key file kept off the front-desk PC (e.g. on a USB stick).
+const (
+	encryptionConfigPath = "customer_data/encryption.json"
+	passphraseEnv        = "RENTAL_BILLING_PASSPHRASE"
+	keyFileEnv           = "RENTAL_BILLING_KEY_FILE"
+	encryptionCheckText  = "rental-billing"
+)
+
+// encryptedMagic starts every encrypted file so that plain files written
+// before encryption was enabled can still be read
+var encryptedMagic = []byte("RBENC1\n")
+
+// Files holding customer PII, encrypted together with the ID photos
+var encryptedDataFiles = []string{"customer_data/customers.json", "customer_data/bills.json"}
+
+const idPhotosDir = "customer_data/id_photos"
+
+var errDataLocked = errors.New("customer data is encrypted and has not been unlocked")
+
+type encryptionConfig struct {
+	Mode  string `json:"mode"` // "passphrase" or "key_file"
+	Salt  []byte `json:"salt,omitempty"`
+	N     int    `json:"n,omitempty"`
+	R     int    `json:"r,omitempty"`
+	P     int    `json:"p,omitempty"`
+	Check []byte `json:"check"`
+}
+
+// dataKey is the unlocked key; nil while encryption is off or still locked
+var dataKey []byte
+
+// loadEncryptionConfig returns nil when encryption has not been enabled
+func loadEncryptionConfig() (*encryptionConfig, error) {
+	data, err := ioutil.ReadFile(encryptionConfigPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg encryptionConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", encryptionConfigPath, err)
+	}
+	return &cfg, nil
+}
+
+func encryptionEnabled() bool {
+	cfg, err := loadEncryptionConfig()
+	return cfg != nil || err != nil
+}
+
+func sealWithKey(key, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte{}, encryptedMagic...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plain, nil), nil
+}
+
+func openWithKey(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted data is truncated")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key or damaged data")
+	}
+	return plain, nil
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// encryptData encrypts with the unlocked key, or returns the data as is
+// when encryption is off
+func encryptData(plain []byte) ([]byte, error) {
+	if dataKey == nil {
+		if encryptionEnabled() {
+			return nil, errDataLocked
+		}
+		return plain, nil
+	}
+	return sealWithKey(dataKey, plain)
+}
+
+func decryptData(data []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return data, nil
+	}
+	if dataKey == nil {
+		return nil, errDataLocked
+	}
+	return openWithKey(dataKey, data)
+}
+
+// readDataFile reads a file that may be encrypted
+func readDataFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decryptData(data)
+}
+
+// writeDataFile writes a file, encrypting it when encryption is enabled
+func writeDataFile(path string, data []byte, perm os.FileMode) error {
+	out, err := encryptData(data)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, out, perm)
+}
+
+func deriveKey(passphrase string, cfg *encryptionConfig) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), cfg.Salt, cfg.N, cfg.R, cfg.P, 32)
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s is not a valid key file", path)
+	}
+	return key, nil
+}
+
+// unlock checks the key against the stored check value and activates it
+func unlock(cfg *encryptionConfig, key []byte) error {
+	check, err := openWithKey(key, cfg.Check)
+	if err != nil || string(check) != encryptionCheckText {
+		return fmt.Errorf("incorrect passphrase or key file")
+	}
+	dataKey = key
+	return nil
+}
+
+func unlockWithPassphrase(passphrase string) error {
+	cfg, err := loadEncryptionConfig()
+	if err != nil || cfg == nil {
+		return err
+	}
+	if cfg.Mode != "passphrase" {
+		return fmt.Errorf("customer data is encrypted with a key file")
+	}
+	key, err := deriveKey(passphrase, cfg)
+	if err != nil {
+		return err
+	}
+	return unlock(cfg, key)
+}
+
+func unlockWithKeyFile(path string) error {
+	cfg, err := loadEncryptionConfig()
+	if err != nil || cfg == nil {
+		return err
+	}
+	if cfg.Mode != "key_file" {
+		return fmt.Errorf("customer data is encrypted with a passphrase")
+	}
+	key, err := readKeyFile(path)
+	if err != nil {
+		return err
+	}
+	return unlock(cfg, key)
+}
+
+// unlockFromEnv unlocks the data with the passphrase or key file given in
+// the environment. It does nothing when encryption is off.
+func unlockFromEnv() error {
+	cfg, err := loadEncryptionConfig()
+	if err != nil {
+		return err
+	}
+	if cfg == nil || dataKey != nil {
+		return nil
+	}
+	if path := os.Getenv(keyFileEnv); path != "" && cfg.Mode == "key_file" {
+		return unlockWithKeyFile(path)
+	}
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" && cfg.Mode == "passphrase" {
+		return unlockWithPassphrase(passphrase)
+	}
+	if cfg.Mode == "key_file" {
+		return fmt.Errorf("customer data is encrypted: set %s to the key file", keyFileEnv)
+	}
+	return fmt.Errorf("customer data is encrypted: set %s to the passphrase", passphraseEnv)
+}
+
+// setupEncryption creates the encryption config for a new key. With a
+// passphrase the key is derived by scrypt; otherwise a random key is
+// written to newKeyFile.
+func setupEncryption(passphrase, newKeyFile string) error {
+	cfg := &encryptionConfig{}
+	var key []byte
+	if newKeyFile != "" {
+		cfg.Mode = "key_file"
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(newKeyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+			return fmt.Errorf("error writing key file: %v", err)
+		}
+	} else {
+		cfg.Mode = "passphrase"
+		cfg.Salt = make([]byte, 16)
+		if _, err := rand.Read(cfg.Salt); err != nil {
+			return err
+		}
+		cfg.N, cfg.R, cfg.P = 1<<15, 8, 1
+		var err error
+		if key, err = deriveKey(passphrase, cfg); err != nil {
+			return err
+		}
+	}
+
+	check, err := sealWithKey(key, []byte(encryptionCheckText))
+	if err != nil {
+		return err
+	}
+	cfg.Check = check
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll("customer_data", 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(encryptionConfigPath, data, 0644); err != nil {
+		return err
+	}
+	dataKey = key
+	return nil
+}
+
+// encryptFileInPlace encrypts a plain file through a temporary file, so an
+// interrupted run never leaves a half-written file behind
+func encryptFileInPlace(path string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if isEncrypted(data) {
+		return false, nil
+	}
+	out, err := sealWithKey(dataKey, data)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, out, info.Mode().Perm()); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, path)
+}
+
+// encryptDataDir encrypts every plain customer data file and ID photo
+func encryptDataDir() (encrypted, skipped int, err error) {
+	files := append([]string{}, encryptedDataFiles...)
+	photos, _ := filepath.Glob(filepath.Join(idPhotosDir, "*"))
+	files = append(files, photos...)
+
+	for _, path := range files {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		done, err := encryptFileInPlace(path)
+		if err != nil {
+			return encrypted, skipped, fmt.Errorf("%s: %v", path, err)
+		}
+		if done {
+			encrypted++
+		} else {
+			skipped++
+		}
+	}
+
+	done, err := encryptAuditLog()
+	if err != nil {
+		return encrypted, skipped, fmt.Errorf("%s: %v", auditLogPath, err)
+	}
+	if done {
+		encrypted++
+	}
+	return encrypted, skipped, nil
+}
+
+func readPassphrase(prompt string) (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	passphrase, err := readSecret(prompt)
+	if err != nil {
+		return "", fmt.Errorf("no passphrase given")
+	}
+	return passphrase, nil
+}
+
+// readNewPassphrase asks for a new passphrase twice, as a typo would lock
+// the data under a key nobody knows
+func readNewPassphrase(prompt string) (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	passphrase, err := readPassphrase(prompt)
+	if err != nil {
+		return "", err
+	}
+	confirm, err := readPassphrase("Repeat the passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm != passphrase {
+		return "", fmt.Errorf("the passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func runEncryptCommand(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ContinueOnError)
+	keyFile := fs.String("key-file", "", "use this key file instead of a passphrase")
+	newKey := fs.Bool("new-key", false, "create a new random key in --key-file")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", fs.Arg(0))}
+	}
+	if *newKey && *keyFile == "" {
+		return usageError{"--new-key needs --key-file"}
+	}
+
+	cfg, err := loadEncryptionConfig()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case cfg != nil && *newKey:
+		return fmt.Errorf("customer data is already encrypted; changing the key is not supported")
+	case cfg != nil && *keyFile != "":
+		err = unlockWithKeyFile(*keyFile)
+	case cfg != nil:
+		var passphrase string
+		if passphrase, err = readPassphrase("Passphrase: "); err == nil {
+			err = unlockWithPassphrase(passphrase)
+		}
+	case *keyFile != "" && !*newKey:
+		return usageError{"data is not encrypted yet: add --new-key to create the key file"}
+	case *newKey:
+		err = setupEncryption("", *keyFile)
+	default:
+		var passphrase string
+		if passphrase, err = readNewPassphrase("New passphrase (at least 8 characters): "); err == nil {
+			if len(passphrase) < 8 {
+				return usageError{"the passphrase must be at least 8 characters"}
+			}
+			err = setupEncryption(passphrase, "")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var encrypted, skipped int
+	err = withDataLock(func() error {
+		encrypted, skipped, err = encryptDataDir()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d file(s) encrypted, %d already encrypted\n", encrypted, skipped)
+	if *newKey {
+		fmt.Printf("Keep %s safe: without it the customer data cannot be read\n", *keyFile)
+	}
+	return nil
+}
+
+// showUnlockScreen asks for the passphrase or key file before the data is
+// opened, then continues with next
+func showUnlockScreen(window fyne.Window, next func()) {
+	cfg, err := loadEncryptionConfig()
+	if err != nil {
+		window.SetContent(widget.NewLabel("Error reading encryption settings: " + err.Error()))
+		return
+	}
+
+	statusLabel := widget.NewLabel("")
+	var content *fyne.Container
+
+	if cfg.Mode == "key_file" {
+		selectButton := widget.NewButton("Select Key File", func() {
+			dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+				if err != nil || reader == nil {
+					return
+				}
+				reader.Close()
+				if err := unlockWithKeyFile(reader.URI().Path()); err != nil {
+					statusLabel.SetText(err.Error())
+					return
+				}
+				next()
+			}, window)
+		})
+		content = container.NewVBox(
+			widget.NewLabel("Customer data is encrypted."),
+			selectButton,
+			statusLabel,
+		)
+	} else {
+		passphraseEntry := widget.NewPasswordEntry()
+		passphraseEntry.SetPlaceHolder("Admin Passphrase")
+		unlockButton := widget.NewButton("Unlock", func() {
+			if err := unlockWithPassphrase(passphraseEntry.Text); err != nil {
+				statusLabel.SetText(err.Error())
+				return
+			}
+			next()
+		})
+		passphraseEntry.OnSubmitted = func(string) { unlockButton.OnTapped() }
+		content = container.NewVBox(
+			widget.NewLabel("Customer data is encrypted."),
+			passphraseEntry,
+			unlockButton,
+			statusLabel,
+		)
+	}
+
+	window.SetContent(container.NewPadded(content))
+}
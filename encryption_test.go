@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadNewPassphraseNeedsConfirmation(t *testing.T) {
+	t.Setenv(passphraseEnv, "")
+	defer func(r *bufio.Reader) { stdin = r }(stdin)
+
+	stdin = bufio.NewReader(strings.NewReader("correct horse\ncorrect hrose\n"))
+	if _, err := readNewPassphrase("New passphrase: "); err == nil {
+		t.Error("passphrases that differ were accepted")
+	}
+
+	stdin = bufio.NewReader(strings.NewReader("correct horse\ncorrect horse\n"))
+	if got, err := readNewPassphrase("New passphrase: "); err != nil || got != "correct horse" {
+		t.Errorf("readNewPassphrase = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Form C must reach the FRRO within 24 hours of a foreign guest's arrival
+const formCDeadline = 24 * time.Hour
+
+const formCDir = "FormC"
+
+var formCGenders = []string{"Male", "Female", "Transgender"}
+
+var visaTypes = []string{
+	"Tourist", "e-Tourist", "Business", "e-Business", "Employment", "Student",
+	"Medical", "e-Medical", "Conference", "Journalist", "Research", "Transit",
+	"Entry (X)", "OCI Card",
+}
+
+var (
+	// Foreign passports do not follow the Indian letter and 7 digits
+	foreignPassportPattern = regexp.MustCompile(`^[A-Z0-9]{6,12}$`)
+	visaNumberPattern      = regexp.MustCompile(`^[A-Z0-9]{4,20}$`)
+)
+
+// ForeignDetails are the Form C particulars of a foreign national. The
+// passport number is kept as the customer's ID number.
+type ForeignDetails struct {
+	Gender          string    `json:"gender"`
+	DateOfBirth     time.Time `json:"date_of_birth"`
+	PassportExpiry  time.Time `json:"passport_expiry"`
+	VisaNumber      string    `json:"visa_number"`
+	VisaType        string    `json:"visa_type"`
+	VisaExpiry      time.Time `json:"visa_expiry"`
+	ArrivedInIndia  time.Time `json:"arrived_in_india"`
+	NextDestination string    `json:"next_destination"`
+}
+
+// FormCFiling records that a stay was reported to the FRRO
+type FormCFiling struct {
+	Reference   string    `json:"reference"`
+	SubmittedOn time.Time `json:"submitted_on"`
+	By          string    `json:"by"`
+}
+
+func validateForeignPassport(number string) error {
+	if !foreignPassportPattern.MatchString(normalizeGovID(number)) {
+		return fmt.Errorf("passport number must be 6 to 12 letters and digits")
+	}
+	return nil
+}
+
+// foreignNationality reports whether a nationality is other than Indian
+func foreignNationality(nationality string) bool {
+	nationality = strings.TrimSpace(nationality)
+	return nationality != "" && !strings.EqualFold(nationality, "Indian")
+}
+
+// validateForeignCustomer checks a foreign national's passport and Form C
+// particulars
+func validateForeignCustomer(customer Customer) error {
+	return validateForeignNational(customer.Nationality, customer.GovIDType, customer.GovIDNumber, customer.Foreign)
+}
+
+// validateForeignNational checks the passport and Form C particulars of a
+// customer or another guest on the stay
+func validateForeignNational(nationality, idType, idNumber string, f *ForeignDetails) error {
+	if idType != "Passport" {
+		return fmt.Errorf("foreign nationals must be registered with their passport")
+	}
+	if err := validateForeignPassport(idNumber); err != nil {
+		return fmt.Errorf("ID number: %v", err)
+	}
+	if !foreignNationality(nationality) {
+		return fmt.Errorf("please enter the nationality of the foreign national")
+	}
+
+	if !slices.Contains(formCGenders, f.Gender) {
+		return fmt.Errorf("please select the gender")
+	}
+	if f.DateOfBirth.IsZero() || !f.DateOfBirth.Before(time.Now()) {
+		return fmt.Errorf("please enter a valid date of birth")
+	}
+	if f.PassportExpiry.IsZero() {
+		return fmt.Errorf("please enter the passport expiry date")
+	}
+	if !visaNumberPattern.MatchString(f.VisaNumber) {
+		return fmt.Errorf("visa number must be 4 to 20 letters and digits")
+	}
+	if !slices.Contains(visaTypes, f.VisaType) {
+		return fmt.Errorf("please select the visa type")
+	}
+	if f.VisaExpiry.IsZero() {
+		return fmt.Errorf("please enter the visa expiry date")
+	}
+	if f.ArrivedInIndia.IsZero() || f.ArrivedInIndia.Before(f.DateOfBirth) {
+		return fmt.Errorf("please enter a valid date of arrival in India")
+	}
+	if f.VisaExpiry.Before(f.ArrivedInIndia) {
+		return fmt.Errorf("visa expiry cannot be before the date of arrival in India")
+	}
+	if strings.TrimSpace(f.NextDestination) == "" {
+		return fmt.Errorf("please enter the next destination")
+	}
+	return nil
+}
+
+// formCOccupant is a foreign national on a stay: the customer or another
+// guest. Guests share the customer's address and phone number.
+type formCOccupant struct {
+	Name        string
+	Nationality string
+	Passport    string
+	Foreign     *ForeignDetails
+}
+
+// foreignOccupants returns the foreign nationals on a stay, the customer first
+func (b Bill) foreignOccupants() []formCOccupant {
+	var occupants []formCOccupant
+	if c := b.Customer; c.Foreign != nil {
+		occupants = append(occupants, formCOccupant{c.Name, c.nationality(), c.GovIDNumber, c.Foreign})
+	}
+	for _, g := range b.Guests {
+		if g.Foreign != nil {
+			occupants = append(occupants, formCOccupant{g.Name, g.nationality(), g.GovIDNumber, g.Foreign})
+		}
+	}
+	return occupants
+}
+
+// formCDue is a stay with foreign guests that has not been reported yet
+type formCDue struct {
+	Bill     Bill
+	Due      time.Time
+	Warnings []string
+}
+
+func (d formCDue) overdue(now time.Time) bool {
+	return now.After(d.Due)
+}
+
+func (d formCDue) label(now time.Time) string {
+	status := "due by " + d.Due.Format("02-01-2006 15:04")
+	if d.overdue(now) {
+		status = "OVERDUE since " + d.Due.Format("02-01-2006 15:04")
+	}
+	var names []string
+	for _, o := range d.Bill.foreignOccupants() {
+		names = append(names, o.Name+" ("+o.Nationality+")")
+	}
+	text := fmt.Sprintf("%s  %s  arrived %s  %s", d.Bill.BillNumber, strings.Join(names, ", "),
+		d.Bill.arrival().Format("02-01-2006 15:04"), status)
+	if len(d.Warnings) > 0 {
+		text += "  - " + strings.Join(d.Warnings, ", ")
+	}
+	return text
+}
+
+// pendingFormC lists the stays with foreign guests not yet reported to the
+// FRRO, most urgent first
+func pendingFormC(bills []Bill) []formCDue {
+	var pending []formCDue
+	for _, bill := range activeBills(bills) {
+		occupants := bill.foreignOccupants()
+		if len(occupants) == 0 || bill.FormC != nil || len(bill.Items) == 0 {
+			continue
+		}
+		d := formCDue{Bill: bill, Due: bill.arrival().Add(formCDeadline)}
+		departure := bill.departure()
+		for _, o := range occupants {
+			f := o.Foreign
+			if dateOnly(f.VisaExpiry).Before(dateOnly(departure)) {
+				d.Warnings = append(d.Warnings, o.Name+"'s visa expires "+f.VisaExpiry.Format("02-01-2006")+" before departure")
+			}
+			if dateOnly(f.PassportExpiry).Before(dateOnly(departure)) {
+				d.Warnings = append(d.Warnings, o.Name+"'s passport expires "+f.PassportExpiry.Format("02-01-2006")+" before departure")
+			}
+		}
+		pending = append(pending, d)
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Due.Before(pending[j].Due)
+	})
+	return pending
+}
+
+// markFormCSubmitted records the FRRO reference of a reported stay
+func (db *BillDB) markFormCSubmitted(billNumber, reference string) error {
+	reference = strings.TrimSpace(reference)
+	if reference == "" {
+		return fmt.Errorf("please enter the Form C reference number")
+	}
+	return db.change(func() error {
+		for i, b := range db.bills {
+			if b.BillNumber != billNumber {
+				continue
+			}
+			if len(b.foreignOccupants()) == 0 {
+				return fmt.Errorf("bill %s has no foreign nationals", billNumber)
+			}
+			db.bills[i].FormC = &FormCFiling{
+				Reference:   reference,
+				SubmittedOn: time.Now(),
+				By:          actingUser(),
+			}
+			return logChangeLocked(auditUpdate, auditBill, billNumber, b, db.bills[i], db.saveBills)
+		}
+		return fmt.Errorf("bill %s not found", billNumber)
+	})
+}
+
+// splitName splits a name into given name and surname for Form C, which
+// asks for them separately
+func splitName(name string) (given, surname string) {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, " "); i > 0 {
+		return strings.TrimSpace(name[:i]), name[i+1:]
+	}
+	return name, ""
+}
+
+// Columns in the order of the fields on the FRRO Form C screen
+var formCColumns = []string{
+	"Given Name", "Surname", "Gender", "Date of Birth", "Nationality",
+	"Permanent Address", "Passport Number", "Passport Expiry Date",
+	"Visa Number", "Visa Type", "Visa Expiry Date", "Date of Arrival in India",
+	"Arrived From", "Date of Arrival in Hotel", "Time of Arrival in Hotel",
+	"Intended Duration of Stay (Days)", "Purpose of Visit", "Next Destination",
+	"Mobile Number", "Room Number", "Bill Number",
+}
+
+// formCRecords returns one Form C row for each foreign national on a stay
+func formCRecords(bill Bill) [][]string {
+	var records [][]string
+	for _, o := range bill.foreignOccupants() {
+		records = append(records, formCRecord(bill, o))
+	}
+	return records
+}
+
+func formCRecord(bill Bill, o formCOccupant) []string {
+	c := bill.Customer
+	f := o.Foreign
+	given, surname := splitName(o.Name)
+	arrival := bill.arrival()
+	days := 0
+	for _, item := range bill.Items {
+		days += item.Days
+	}
+	next := bill.GoingTo
+	if next == "" {
+		next = f.NextDestination
+	}
+	date := func(t time.Time) string { return t.Format("02/01/2006") }
+	return []string{
+		given, surname, f.Gender, date(f.DateOfBirth), o.Nationality,
+		c.Address, o.Passport, date(f.PassportExpiry),
+		f.VisaNumber, f.VisaType, date(f.VisaExpiry), date(f.ArrivedInIndia),
+		bill.ComingFrom, date(arrival), arrival.Format("15:04"),
+		strconv.Itoa(days), bill.Purpose, next,
+		c.Phone, stayRooms(bill), bill.BillNumber,
+	}
+}
+
+// writeFormCCSV exports the stays with the full passport numbers the FRRO
+// portal needs
+func writeFormCCSV(bills []Bill, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write(formCColumns)
+	for _, bill := range bills {
+		for _, record := range formCRecords(bill) {
+			w.Write(record)
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// foreignDetailsForm captures the Form C particulars in the Add New
+// Customer window
+type foreignDetailsForm struct {
+	content fyne.CanvasObject
+
+	gender          *widget.Select
+	dateOfBirth     *widget.Entry
+	passportExpiry  *widget.Entry
+	visaNumber      *widget.Entry
+	visaType        *widget.Select
+	visaExpiry      *widget.Entry
+	arrivedInIndia  *widget.Entry
+	nextDestination *widget.Entry
+}
+
+func newForeignDetailsForm() *foreignDetailsForm {
+	dateEntry := func(placeHolder string) *widget.Entry {
+		e := widget.NewEntry()
+		e.SetPlaceHolder(placeHolder + " (DD-MM-YYYY)")
+		return e
+	}
+	f := &foreignDetailsForm{
+		gender:          widget.NewSelect(formCGenders, nil),
+		dateOfBirth:     dateEntry("Date of Birth"),
+		passportExpiry:  dateEntry("Passport Expiry"),
+		visaNumber:      widget.NewEntry(),
+		visaType:        widget.NewSelect(visaTypes, nil),
+		visaExpiry:      dateEntry("Visa Expiry"),
+		arrivedInIndia:  dateEntry("Date of Arrival in India"),
+		nextDestination: widget.NewEntry(),
+	}
+	f.gender.PlaceHolder = "Gender"
+	f.visaNumber.SetPlaceHolder("Visa Number")
+	f.visaType.PlaceHolder = "Visa Type"
+	f.nextDestination.SetPlaceHolder("Next Destination")
+
+	f.content = container.NewVBox(
+		widget.NewLabel("Form C Details:"),
+		container.NewGridWithColumns(2, f.gender, f.dateOfBirth),
+		f.passportExpiry,
+		container.NewGridWithColumns(2, f.visaNumber, f.visaType),
+		container.NewGridWithColumns(2, f.visaExpiry, f.arrivedInIndia),
+		f.nextDestination,
+	)
+	return f
+}
+
+func (f *foreignDetailsForm) details() (*ForeignDetails, error) {
+	d := &ForeignDetails{
+		Gender:          f.gender.Selected,
+		VisaNumber:      normalizeGovID(f.visaNumber.Text),
+		VisaType:        f.visaType.Selected,
+		NextDestination: strings.TrimSpace(f.nextDestination.Text),
+	}
+	dates := []struct {
+		name  string
+		entry *widget.Entry
+		date  *time.Time
+	}{
+		{"date of birth", f.dateOfBirth, &d.DateOfBirth},
+		{"passport expiry", f.passportExpiry, &d.PassportExpiry},
+		{"visa expiry", f.visaExpiry, &d.VisaExpiry},
+		{"date of arrival in India", f.arrivedInIndia, &d.ArrivedInIndia},
+	}
+	for _, field := range dates {
+		text := strings.TrimSpace(field.entry.Text)
+		if text == "" {
+			return nil, fmt.Errorf("please enter the %s", field.name)
+		}
+		t, err := parseBatchDate(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid date %q, use DD-MM-YYYY", field.name, text)
+		}
+		*field.date = t
+	}
+	return d, nil
+}
+
+func (f *foreignDetailsForm) reset() {
+	f.gender.ClearSelected()
+	f.visaType.ClearSelected()
+	for _, e := range []*widget.Entry{f.dateOfBirth, f.passportExpiry, f.visaNumber,
+		f.visaExpiry, f.arrivedInIndia, f.nextDestination} {
+		e.SetText("")
+	}
+}
+
+// foreignDetailsText describes the Form C particulars in the customer profile
+func foreignDetailsText(f *ForeignDetails) string {
+	return fmt.Sprintf("Visa: %s %s, expires %s\nPassport expires: %s\nArrived in India: %s\nNext destination: %s",
+		f.VisaType, f.VisaNumber, f.VisaExpiry.Format("02-01-2006"), f.PassportExpiry.Format("02-01-2006"),
+		f.ArrivedInIndia.Format("02-01-2006"), f.NextDestination)
+}
+
+func showFormCWindow(myApp fyne.App, billDB *BillDB) {
+	window := myApp.NewWindow("Form C - Foreign Guests")
+
+	var pending []formCDue
+	selected := -1
+	list := widget.NewList(
+		func() int { return len(pending) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(pending[i].label(time.Now()))
+		},
+	)
+	list.OnSelected = func(i widget.ListItemID) {
+		selected = i
+	}
+
+	statusLabel := widget.NewLabel("")
+	refresh := func() {
+		pending = pendingFormC(billDB.getBills())
+		selected = -1
+		list.UnselectAll()
+		list.Refresh()
+		overdue := 0
+		for _, d := range pending {
+			if d.overdue(time.Now()) {
+				overdue++
+			}
+		}
+		statusLabel.SetText(fmt.Sprintf("%d stay(s) to report, %d overdue", len(pending), overdue))
+	}
+
+	exportButton := widget.NewButton("Export Pending for FRRO", func() {
+		if len(pending) == 0 {
+			statusLabel.SetText("There are no stays to report")
+			return
+		}
+		var bills []Bill
+		for _, d := range pending {
+			bills = append(bills, d.Bill)
+		}
+		path := filepath.Join(formCDir, fmt.Sprintf("formc_%s.csv", time.Now().Format("20060102_150405")))
+		if err := writeFormCCSV(bills, path); err != nil {
+			statusLabel.SetText("Error exporting Form C: " + err.Error())
+			return
+		}
+		statusLabel.SetText(fmt.Sprintf("%d stay(s) exported to %s", len(bills), path))
+	})
+
+	submittedButton := widget.NewButton("Mark Selected as Submitted", func() {
+		if selected < 0 || selected >= len(pending) {
+			statusLabel.SetText("Please select a stay first")
+			return
+		}
+		billNumber := pending[selected].Bill.BillNumber
+		referenceEntry := widget.NewEntry()
+		referenceEntry.SetPlaceHolder("Form C Reference Number")
+		dialog.ShowForm("Form C Submitted - "+billNumber, "Save", "Cancel",
+			[]*widget.FormItem{widget.NewFormItem("Reference", referenceEntry)},
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := billDB.markFormCSubmitted(billNumber, referenceEntry.Text); err != nil {
+					dialog.ShowError(err, window)
+					return
+				}
+				refresh()
+			}, window)
+	})
+
+	refresh()
+
+	top := container.NewVBox(
+		widget.NewLabel("Report every foreign guest to the FRRO within 24 hours of arrival."),
+		container.NewGridWithColumns(3, widget.NewButton("Refresh", refresh), exportButton, submittedButton),
+		statusLabel,
+	)
+	window.SetContent(container.NewPadded(container.NewBorder(top, nil, nil, nil, list)))
+	window.Resize(fyne.NewSize(750, 450))
+	window.Show()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testForeignDetails() *ForeignDetails {
+	return &ForeignDetails{
+		Gender:          "Female",
+		DateOfBirth:     time.Date(1990, 4, 21, 0, 0, 0, 0, time.Local),
+		PassportExpiry:  time.Date(2030, 1, 1, 0, 0, 0, 0, time.Local),
+		VisaNumber:      "VT1234567",
+		VisaType:        "e-Tourist",
+		VisaExpiry:      time.Date(2026, 12, 1, 0, 0, 0, 0, time.Local),
+		ArrivedInIndia:  time.Date(2026, 5, 1, 0, 0, 0, 0, time.Local),
+		NextDestination: "Goa",
+	}
+}
+
+func TestFormCRowPerForeignGuest(t *testing.T) {
+	bill := testB2BBill("B1")
+	bill.Adults = 3
+	bill.Guests = []StayGuest{
+		{Name: "Anna Schmidt", AgeBand: ageBandAdult, Relation: "Friend", Nationality: "German",
+			GovIDType: "Passport", GovIDNumber: "C01X00T47", Foreign: testForeignDetails()},
+		{Name: "Priya Kumar", AgeBand: ageBandAdult, Relation: "Spouse",
+			GovIDType: "Passport", GovIDNumber: "K1234567"},
+	}
+	if err := validateStayGuests(bill); err != nil {
+		t.Fatal(err)
+	}
+
+	pending := pendingFormC([]Bill{bill})
+	if len(pending) != 1 {
+		t.Fatalf("stay of an Indian customer with a foreign guest is not pending: %+v", pending)
+	}
+	records := formCRecords(bill)
+	if len(records) != 1 {
+		t.Fatalf("%d Form C rows, want 1 for the foreign guest", len(records))
+	}
+	if got := strings.Join(records[0][:7], "|"); got != "Anna|Schmidt|Female|21/04/1990|German|"+bill.Customer.Address+"|C01X00T47" {
+		t.Errorf("Form C row starts %s", got)
+	}
+
+	bill.Customer.Nationality = "German"
+	bill.Customer.GovIDType = "Passport"
+	bill.Customer.GovIDNumber = "C01X00T48"
+	bill.Customer.Foreign = testForeignDetails()
+	if records := formCRecords(bill); len(records) != 2 || records[0][6] != "C01X00T48" {
+		t.Errorf("Form C rows = %v, want the customer and then the guest", records)
+	}
+}
+
+func TestForeignGuestNeedsFormCDetails(t *testing.T) {
+	g := StayGuest{Name: "Anna Schmidt", AgeBand: ageBandChild, Relation: "Child", Nationality: "German"}
+	if err := validateStayGuest(g); err == nil {
+		t.Error("foreign guest without Form C details was accepted")
+	}
+	g.Foreign = testForeignDetails()
+	if err := validateStayGuest(g); err == nil {
+		t.Error("foreign guest without a passport was accepted")
+	}
+	g.GovIDType, g.GovIDNumber = "Passport", "C01X00T47"
+	if err := validateStayGuest(g); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBatchForeignCustomer(t *testing.T) {
+	csv := "customer_name,address,phone,nationality,id_type,id_number,room,rate,from,to," +
+		"gender,date_of_birth,passport_expiry,visa_number,visa_type,visa_expiry,arrived_in_india,next_destination\n" +
+		"Anna Schmidt,Berlin,+49301234567,German,Passport,C01X00T47,AC Room,2500,2026-05-04,2026-05-06," +
+		"Female,1990-04-21,2030-01-01,VT1234567,e-Tourist,2026-12-01,2026-05-01,Goa\n"
+	rows, err := readBatchCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	customer, err := rows[0].Customer.customer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCustomer(customer); err != nil {
+		t.Fatal(err)
+	}
+	if customer.Foreign == nil || customer.Foreign.VisaType != "e-Tourist" {
+		t.Errorf("Form C details not read: %+v", customer.Foreign)
+	}
+
+	rows[0].Customer.Foreign = nil
+	customer, _ = rows[0].Customer.customer()
+	if err := validateCustomer(customer); err == nil {
+		t.Error("foreign customer without Form C details was accepted")
+	}
+}
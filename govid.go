@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// govIDHints describe the expected format of each ID type
+var govIDHints = map[string]string{
+	"Aadhaar Card":    "12-digit Aadhaar number, e.g. 2345 6789 0124",
+	"PAN Card":        "10-character PAN, e.g. ABCPE1234F",
+	"Driving License": "State code and number, e.g. TN01 20150012345",
+	"Passport":        "Letter and 7 digits, e.g. K1234567",
+	"Voter ID":        "EPIC number, 3 letters and 7 digits, e.g. ABC1234567",
+}
+
+var (
+	aadhaarPattern  = regexp.MustCompile(`^[2-9][0-9]{11}$`)
+	panPattern      = regexp.MustCompile(`^[A-Z]{3}[ABCFGHJLPT][A-Z][0-9]{4}[A-Z]$`)
+	passportPattern = regexp.MustCompile(`^[A-PR-WY][0-9]{7}$`)
+	epicPattern     = regexp.MustCompile(`^[A-Z]{3}[0-9]{7}$`)
+	dlPattern       = regexp.MustCompile(`^([A-Z]{2})([0-9]{2})([0-9]{4})([0-9]{7})$`)
+	dlOldPattern    = regexp.MustCompile(`^([A-Z]{2})[0-9A-Z]{7,18}$`)
+)
+
+// Licensing state codes used by the RTOs in driving licence numbers
+var dlStateCodes = map[string]bool{
+	"AN": true, "AP": true, "AR": true, "AS": true, "BR": true, "CG": true, "CH": true,
+	"DD": true, "DL": true, "DN": true, "GA": true, "GJ": true, "HP": true, "HR": true,
+	"JH": true, "JK": true, "KA": true, "KL": true, "LA": true, "LD": true, "MH": true,
+	"ML": true, "MN": true, "MP": true, "MZ": true, "NL": true, "OD": true, "OR": true,
+	"PB": true, "PY": true, "RJ": true, "SK": true, "TN": true, "TR": true, "TS": true,
+	"UK": true, "UP": true, "WB": true,
+}
+
+// dlStateFormat is a state's numbering of licences issued before Sarathi.
+// The year of issue is the first group of the pattern.
+type dlStateFormat struct {
+	pattern *regexp.Regexp
+	example string
+}
+
+// Older licence formats of Tamil Nadu and the neighbouring states. Tamil
+// Nadu, Puducherry and Karnataka print the RTO, year of issue and serial;
+// Kerala, Andhra Pradesh and Telangana the RTO, serial and year.
+var dlStateFormats = map[string]dlStateFormat{
+	"TN": dlYearFirst("TN", "TN-01/2008/0012345"),
+	"PY": dlYearFirst("PY", "PY-01/2008/0012345"),
+	"KA": dlYearFirst("KA", "KA-05/2008/0012345"),
+	"KL": dlSerialFirst("KL", "KL-07/1234/2008"),
+	"AP": dlSerialFirst("AP", "AP-09/123456/2005"),
+	"TS": dlSerialFirst("TS", "TS-09/123456/2015"),
+}
+
+func dlYearFirst(state, example string) dlStateFormat {
+	return dlStateFormat{regexp.MustCompile(`^` + state + `[0-9]{2}((?:19|20)[0-9]{2})[0-9]{1,7}$`), example}
+}
+
+func dlSerialFirst(state, example string) dlStateFormat {
+	return dlStateFormat{regexp.MustCompile(`^` + state + `[0-9]{2}[0-9]{1,7}((?:19|20)[0-9]{2})$`), example}
+}
+
+// Verhoeff checksum tables, used for the last digit of Aadhaar numbers
+var (
+	verhoeffD = [10][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+		{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+		{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+		{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffP = [8][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+		{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 7, 6, 8, 0},
+		{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+		{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+)
+
+// verhoeffValid reports whether a string of digits ends in a correct
+// Verhoeff check digit
+func verhoeffValid(digits string) bool {
+	c := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		c = verhoeffD[c][verhoeffP[i%8][d]]
+	}
+	return c == 0
+}
+
+// normalizeGovID upper-cases an ID number and removes spaces, hyphens and
+// slashes, which people type in different places
+func normalizeGovID(number string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '/', '.':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(number)))
+}
+
+// validateGovID checks the format of a government ID number for its type
+func validateGovID(idType, number string) error {
+	n := normalizeGovID(number)
+	if n == "" {
+		return fmt.Errorf("please enter the %s number", idType)
+	}
+
+	switch idType {
+	case "Aadhaar Card":
+		if len(n) != 12 || strings.Trim(n, "0123456789") != "" {
+			return fmt.Errorf("the Aadhaar number must have 12 digits")
+		}
+		if !aadhaarPattern.MatchString(n) {
+			return fmt.Errorf("the Aadhaar number cannot start with 0 or 1")
+		}
+		if !verhoeffValid(n) {
+			return fmt.Errorf("the Aadhaar number is not valid, please check it for typing mistakes")
+		}
+	case "PAN Card":
+		if !panPattern.MatchString(n) {
+			return fmt.Errorf("the PAN must be 5 letters, 4 digits and a letter, e.g. ABCPE1234F")
+		}
+	case "Passport":
+		if !passportPattern.MatchString(n) {
+			return fmt.Errorf("passport number must be a letter followed by 7 digits, e.g. K1234567")
+		}
+	case "Voter ID":
+		if !epicPattern.MatchString(n) {
+			return fmt.Errorf("the Voter ID (EPIC) number must be 3 letters followed by 7 digits")
+		}
+	case "Driving License":
+		// Licences issued or renewed through Sarathi have the national
+		// format and are checked in full. Older licences follow each state's
+		// own numbering, which is checked for the states in dlStateFormats
+		// and only by the state code for the others.
+		if m := dlPattern.FindStringSubmatch(n); m != nil {
+			if !dlStateCodes[m[1]] {
+				return fmt.Errorf("driving licence has an unknown state code %s", m[1])
+			}
+			if year, _ := strconv.Atoi(m[3]); year < 1950 || year > time.Now().Year() {
+				return fmt.Errorf("driving licence has an invalid year of issue %s", m[3])
+			}
+			return nil
+		}
+		m := dlOldPattern.FindStringSubmatch(n)
+		if m == nil {
+			return fmt.Errorf("driving licence number must be a state code followed by the number, e.g. TN01 20150012345")
+		}
+		if !dlStateCodes[m[1]] {
+			return fmt.Errorf("driving licence has an unknown state code %s", m[1])
+		}
+		if format, ok := dlStateFormats[m[1]]; ok {
+			fm := format.pattern.FindStringSubmatch(n)
+			if fm == nil {
+				return fmt.Errorf("driving licence number must be in the national format, e.g. %s01 20150012345, or the older %s format, e.g. %s",
+					m[1], m[1], format.example)
+			}
+			if year, _ := strconv.Atoi(fm[1]); year > time.Now().Year() {
+				return fmt.Errorf("driving licence has an invalid year of issue %s", fm[1])
+			}
+		}
+	default:
+		return fmt.Errorf("unknown ID type %q", idType)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestVerhoeffValid(t *testing.T) {
+	for _, tc := range []struct {
+		digits string
+		valid  bool
+	}{
+		{"2363", true},
+		{"2364", false},
+		{"234567890124", true},
+		{"234567890125", false}, // wrong check digit
+		{"234567890214", false}, // adjacent digits swapped
+		{"324567890124", false},
+		{"999941057058", true},
+	} {
+		if got := verhoeffValid(tc.digits); got != tc.valid {
+			t.Errorf("verhoeffValid(%s) = %v, want %v", tc.digits, got, tc.valid)
+		}
+	}
+}
+
+func TestValidateGovID(t *testing.T) {
+	for _, tc := range []struct {
+		idType, number string
+		valid          bool
+	}{
+		{"Aadhaar Card", "2345 6789 0124", true},
+		{"Aadhaar Card", "1345 6789 0124", false},
+		{"Aadhaar Card", "2345 6789 0125", false},
+		{"PAN Card", "abcpe1234f", true},
+		{"PAN Card", "ABCXE1234F", false},
+		{"Passport", "K1234567", true},
+		{"Passport", "Q1234567", false},
+		{"Voter ID", "ABC1234567", true},
+		{"Driving License", "TN01 20150012345", true},
+		{"Driving License", "TN01 20990012345", false}, // year of issue in the future
+		{"Driving License", "XX01 20150012345", false},
+		{"Driving License", "DL-04-2011-0149646", true},
+		{"Driving License", "KL-07/1234/2008", true}, // older state format
+		{"Driving License", "KL-07/1234/2099", false},
+		{"Driving License", "TN-02/1998/12345", true},
+		{"Driving License", "TN-02/12345/1998", false}, // Kerala order in Tamil Nadu
+		{"Driving License", "AP-09/123456/2005", true},
+		{"Driving License", "KA-05/2008/0012345", true},
+		{"Driving License", "MH-12/ABC/1234567", true}, // not checked beyond the state code
+		{"Driving License", "MH12", false},
+		{"Driving License", "XY 1234567", false},
+	} {
+		if err := validateGovID(tc.idType, tc.number); (err == nil) != tc.valid {
+			t.Errorf("validateGovID(%s, %s) = %v, want valid %v", tc.idType, tc.number, err, tc.valid)
+		}
+	}
+}
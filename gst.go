@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Property registration details used on invoices and GST returns
+const (
+	sellerName       = "Trinity Stays"
+	sellerAddress    = "123, Main Street"
+	sellerLocation   = "Chennai"
+	sellerPin        = 600001
+	sellerPhone      = "9876543210"
+	sellerGSTIN      = "33AALCT2345K1ZB"
+	sellerStateCode  = "33"
+	gstRate          = 18.0
+	sacAccommodation = "996311"
+)
+
+// GST state codes as used in GSTINs and the place of supply field
+var gstStates = map[string]string{
+	"01": "Jammu and Kashmir",
+	"02": "Himachal Pradesh",
+	"03": "Punjab",
+	"04": "Chandigarh",
+	"05": "Uttarakhand",
+	"06": "Haryana",
+	"07": "Delhi",
+	"08": "Rajasthan",
+	"09": "Uttar Pradesh",
+	"10": "Bihar",
+	"11": "Sikkim",
+	"12": "Arunachal Pradesh",
+	"13": "Nagaland",
+	"14": "Manipur",
+	"15": "Mizoram",
+	"16": "Tripura",
+	"17": "Meghalaya",
+	"18": "Assam",
+	"19": "West Bengal",
+	"20": "Jharkhand",
+	"21": "Odisha",
+	"22": "Chhattisgarh",
+	"23": "Madhya Pradesh",
+	"24": "Gujarat",
+	"26": "Dadra and Nagar Haveli and Daman and Diu",
+	"27": "Maharashtra",
+	"29": "Karnataka",
+	"30": "Goa",
+	"31": "Lakshadweep",
+	"32": "Kerala",
+	"33": "Tamil Nadu",
+	"34": "Puducherry",
+	"35": "Andaman and Nicobar Islands",
+	"36": "Telangana",
+	"37": "Andhra Pradesh",
+	"38": "Ladakh",
+	"97": "Other Territory",
+}
+
+var gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+
+// stateLabel formats a state code the way the GST offline tool expects, e.g. "33-Tamil Nadu"
+func stateLabel(code string) string {
+	return fmt.Sprintf("%s-%s", code, gstStates[code])
+}
+
+const gstinCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+func validateGSTIN(gstin string) error {
+	if !gstinPattern.MatchString(gstin) {
+		return fmt.Errorf("invalid GSTIN format: %s", gstin)
+	}
+	if _, ok := gstStates[gstin[:2]]; !ok {
+		return fmt.Errorf("invalid state code in GSTIN: %s", gstin[:2])
+	}
+	if gstinCheckDigit(gstin[:14]) != gstin[14] {
+		return fmt.Errorf("invalid GSTIN checksum: %s", gstin)
+	}
+	return nil
+}
+
+// gstinCheckDigit computes the base-36 check character of a GSTIN
+// from its first 14 characters.
+func gstinCheckDigit(body string) byte {
+	sum := 0
+	for i := 0; i < len(body); i++ {
+		factor := 1
+		if i%2 == 1 {
+			factor = 2
+		}
+		product := strings.IndexByte(gstinCharset, body[i]) * factor
+		sum += product/36 + product%36
+	}
+	return gstinCharset[(36-sum%36)%36]
+}
+
+// stateCodeFromGSTIN returns the state code encoded in the first two digits
+func stateCodeFromGSTIN(gstin string) string {
+	if len(gstin) < 2 {
+		return ""
+	}
+	return gstin[:2]
+}
+
+// billAmounts holds the tax breakup of a bill
+type billAmounts struct {
+	Taxable float64
+	IGST    float64
+	CGST    float64
+	SGST    float64
+	Total   float64
+}
+
+func (a billAmounts) Tax() float64 {
+	return a.IGST + a.CGST + a.SGST
+}
+
+// isInterState reports whether IGST applies. Accommodation is supplied where
+// the property is located (IGST Act s.12(3)), so new bills always carry the
+// property's state as place of supply and are taxed as CGST+SGST whatever
+// the guest's or company's state.
+func (bill Bill) isInterState() bool {
+	return bill.PlaceOfSupply != "" && bill.PlaceOfSupply != sellerStateCode
+}
+
+// amounts totals the bill, splitting tax per room line so that the
+// totals agree with line-level reporting such as the e-invoice.
+func (bill Bill) amounts() billAmounts {
+	var a billAmounts
+	for _, item := range bill.Items {
+		line := taxSplit(item.Rate*float64(item.Days), bill.isInterState())
+		a.Taxable += line.Taxable
+		a.IGST += line.IGST
+		a.CGST += line.CGST
+		a.SGST += line.SGST
+	}
+	a.Taxable = round2(a.Taxable)
+	a.IGST = round2(a.IGST)
+	a.CGST = round2(a.CGST)
+	a.SGST = round2(a.SGST)
+	a.Total = round2(a.Taxable + a.Tax())
+	return a
+}
+
+// taxSplit computes GST on a taxable amount as IGST or CGST+SGST
+func taxSplit(taxable float64, interState bool) billAmounts {
+	a := billAmounts{Taxable: round2(taxable)}
+	tax := round2(a.Taxable * gstRate / 100)
+	if interState {
+		a.IGST = tax
+	} else {
+		a.CGST = round2(tax / 2)
+		a.SGST = round2(tax - a.CGST)
+	}
+	a.Total = round2(a.Taxable + a.Tax())
+	return a
+}
+
+// plus adds two sets of amounts, e.g. to total bill lines
+func (a billAmounts) plus(b billAmounts) billAmounts {
+	return billAmounts{
+		Taxable: round2(a.Taxable + b.Taxable),
+		IGST:    round2(a.IGST + b.IGST),
+		CGST:    round2(a.CGST + b.CGST),
+		SGST:    round2(a.SGST + b.SGST),
+		Total:   round2(a.Total + b.Total),
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestGSTINCheckDigit(t *testing.T) {
+	for _, tc := range []struct {
+		gstin string
+		valid bool
+	}{
+		{"27AAPFU0939F1ZV", true},
+		{"27AAPFU0939F1ZW", false}, // wrong check character
+		{"27AAPFU0993F1ZV", false}, // adjacent digits swapped
+		{"72AAPFU0939F1ZV", false},
+		{"27AAPFU0939F1V", false},
+		{"99AAPFU0939F1ZV", false}, // unknown state
+	} {
+		if err := validateGSTIN(tc.gstin); (err == nil) != tc.valid {
+			t.Errorf("validateGSTIN(%s) = %v, want valid %v", tc.gstin, err, tc.valid)
+		}
+	}
+	if got := gstinCheckDigit("27AAPFU0939F1Z"); got != 'V' {
+		t.Errorf("gstinCheckDigit = %c, want V", got)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Inter-state B2C invoices above this value are reported individually (B2CL)
+const b2clThreshold = 100000.0
+
+// gstr1Return mirrors the JSON layout accepted by the GST offline tool
+type gstr1Return struct {
+	GSTIN string       `json:"gstin"`
+	FP    string       `json:"fp"`
+	B2B   []gstr1B2B   `json:"b2b,omitempty"`
+	B2CL  []gstr1B2CL  `json:"b2cl,omitempty"`
+	B2CS  []gstr1B2CS  `json:"b2cs,omitempty"`
+	HSN   gstr1HSNList `json:"hsn"`
+}
+
+type gstr1B2B struct {
+	CTIN string         `json:"ctin"`
+	Inv  []gstr1Invoice `json:"inv"`
+}
+
+type gstr1B2CL struct {
+	POS string         `json:"pos"`
+	Inv []gstr1Invoice `json:"inv"`
+}
+
+type gstr1Invoice struct {
+	Inum   string      `json:"inum"`
+	Idt    string      `json:"idt"`
+	Val    float64     `json:"val"`
+	POS    string      `json:"pos,omitempty"`
+	Rchrg  string      `json:"rchrg,omitempty"`
+	InvTyp string      `json:"inv_typ,omitempty"`
+	Itms   []gstr1Item `json:"itms"`
+
+	receiverName string
+}
+
+type gstr1Item struct {
+	Num    int             `json:"num"`
+	ItmDet gstr1ItemDetail `json:"itm_det"`
+}
+
+type gstr1ItemDetail struct {
+	Txval float64 `json:"txval"`
+	Rt    float64 `json:"rt"`
+	Iamt  float64 `json:"iamt"`
+	Camt  float64 `json:"camt"`
+	Samt  float64 `json:"samt"`
+	Csamt float64 `json:"csamt"`
+}
+
+type gstr1B2CS struct {
+	SplyTy string  `json:"sply_ty"`
+	POS    string  `json:"pos"`
+	Typ    string  `json:"typ"`
+	Txval  float64 `json:"txval"`
+	Rt     float64 `json:"rt"`
+	Iamt   float64 `json:"iamt"`
+	Camt   float64 `json:"camt"`
+	Samt   float64 `json:"samt"`
+	Csamt  float64 `json:"csamt"`
+}
+
+type gstr1HSNList struct {
+	Data []gstr1HSNRow `json:"data"`
+}
+
+type gstr1HSNRow struct {
+	Num   int     `json:"num"`
+	HsnSc string  `json:"hsn_sc"`
+	Desc  string  `json:"desc"`
+	Uqc   string  `json:"uqc"`
+	Qty   float64 `json:"qty"`
+	Val   float64 `json:"val"`
+	Txval float64 `json:"txval"`
+	Iamt  float64 `json:"iamt"`
+	Camt  float64 `json:"camt"`
+	Samt  float64 `json:"samt"`
+	Csamt float64 `json:"csamt"`
+}
+
+// validateBillForGSTR1 lists the problems that keep a bill out of the return
+func validateBillForGSTR1(bill Bill) []string {
+	var problems []string
+	if bill.BillNumber == "" {
+		problems = append(problems, "bill number is missing")
+	}
+	if bill.Customer.Name == "" {
+		problems = append(problems, "guest name is missing")
+	}
+	if len(bill.Items) == 0 {
+		problems = append(problems, "bill has no rooms")
+	}
+	if bill.PlaceOfSupply == "" {
+		problems = append(problems, "place of supply (state) is missing")
+	} else if _, ok := gstStates[bill.PlaceOfSupply]; !ok {
+		problems = append(problems, "unknown place of supply state code "+bill.PlaceOfSupply)
+	} else if bill.PlaceOfSupply != sellerStateCode {
+		problems = append(problems, "place of supply "+stateLabel(bill.PlaceOfSupply)+" is not the property's state")
+	}
+	if bill.BillTo != nil && bill.GuestGSTIN == "" {
+		problems = append(problems, "GSTIN of billing company "+bill.BillTo.LegalName+" is missing")
+	}
+	if bill.GuestGSTIN != "" {
+		if err := validateGSTIN(bill.GuestGSTIN); err != nil {
+			problems = append(problems, "guest "+err.Error())
+		}
+	}
+	return problems
+}
+
+// buildGSTR1 prepares the return for the given month. Bills that fail
+// validation are left out and reported as "bill number: problem" strings.
+func buildGSTR1(bills []Bill, year int, month time.Month) (gstr1Return, []string) {
+	ret := gstr1Return{
+		GSTIN: sellerGSTIN,
+		FP:    fmt.Sprintf("%02d%d", int(month), year),
+	}
+
+	var errs []string
+	b2b := map[string]int{}
+	b2cl := map[string]int{}
+	b2cs := map[string]int{}
+	hsn := gstr1HSNRow{
+		Num:   1,
+		HsnSc: sacAccommodation,
+		Desc:  "Room or unit accommodation services",
+		Uqc:   "NA",
+	}
+
+	for _, bill := range activeBills(bills) {
+		if bill.Date.Year() != year || bill.Date.Month() != month {
+			continue
+		}
+		if problems := validateBillForGSTR1(bill); len(problems) > 0 {
+			for _, p := range problems {
+				errs = append(errs, fmt.Sprintf("%s: %s", bill.BillNumber, p))
+			}
+			continue
+		}
+
+		a := bill.amounts()
+		inv := gstr1Invoice{
+			Inum: bill.BillNumber,
+			Idt:  bill.Date.Format("02-01-2006"),
+			Val:  a.Total,
+			Itms: []gstr1Item{{
+				Num: 1,
+				ItmDet: gstr1ItemDetail{
+					Txval: a.Taxable,
+					Rt:    gstRate,
+					Iamt:  a.IGST,
+					Camt:  a.CGST,
+					Samt:  a.SGST,
+				},
+			}},
+			receiverName: bill.Customer.Name,
+		}
+		if bill.BillTo != nil {
+			inv.receiverName = bill.BillTo.LegalName
+		}
+
+		switch {
+		case bill.GuestGSTIN != "":
+			inv.POS = bill.PlaceOfSupply
+			inv.Rchrg = "N"
+			inv.InvTyp = "R"
+			i, ok := b2b[bill.GuestGSTIN]
+			if !ok {
+				i = len(ret.B2B)
+				b2b[bill.GuestGSTIN] = i
+				ret.B2B = append(ret.B2B, gstr1B2B{CTIN: bill.GuestGSTIN})
+			}
+			ret.B2B[i].Inv = append(ret.B2B[i].Inv, inv)
+		case bill.isInterState() && a.Total > b2clThreshold:
+			i, ok := b2cl[bill.PlaceOfSupply]
+			if !ok {
+				i = len(ret.B2CL)
+				b2cl[bill.PlaceOfSupply] = i
+				ret.B2CL = append(ret.B2CL, gstr1B2CL{POS: bill.PlaceOfSupply})
+			}
+			ret.B2CL[i].Inv = append(ret.B2CL[i].Inv, inv)
+		default:
+			supply := "INTRA"
+			if bill.isInterState() {
+				supply = "INTER"
+			}
+			key := supply + bill.PlaceOfSupply
+			i, ok := b2cs[key]
+			if !ok {
+				i = len(ret.B2CS)
+				b2cs[key] = i
+				ret.B2CS = append(ret.B2CS, gstr1B2CS{
+					SplyTy: supply,
+					POS:    bill.PlaceOfSupply,
+					Typ:    "OE",
+					Rt:     gstRate,
+				})
+			}
+			row := &ret.B2CS[i]
+			row.Txval = round2(row.Txval + a.Taxable)
+			row.Iamt = round2(row.Iamt + a.IGST)
+			row.Camt = round2(row.Camt + a.CGST)
+			row.Samt = round2(row.Samt + a.SGST)
+		}
+
+		hsn.Val = round2(hsn.Val + a.Total)
+		hsn.Txval = round2(hsn.Txval + a.Taxable)
+		hsn.Iamt = round2(hsn.Iamt + a.IGST)
+		hsn.Camt = round2(hsn.Camt + a.CGST)
+		hsn.Samt = round2(hsn.Samt + a.SGST)
+	}
+
+	if hsn.Txval > 0 {
+		ret.HSN.Data = []gstr1HSNRow{hsn}
+	}
+	return ret, errs
+}
+
+// exportGSTR1 writes the return as JSON and the offline tool CSV sheets into
+// GSTR1/<MM-YYYY>/ and returns the directory along with validation errors.
+func exportGSTR1(bills []Bill, year int, month time.Month) (string, []string, error) {
+	ret, errs := buildGSTR1(bills, year, month)
+
+	dir := filepath.Join("GSTR1", fmt.Sprintf("%02d-%d", int(month), year))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errs, fmt.Errorf("failed to create GSTR1 directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(ret, "", "  ")
+	if err != nil {
+		return "", errs, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "gstr1.json"), data, 0644); err != nil {
+		return "", errs, err
+	}
+
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	csvDate := func(idt string) string {
+		t, err := time.Parse("02-01-2006", idt)
+		if err != nil {
+			return idt
+		}
+		return t.Format("02-Jan-2006")
+	}
+
+	var b2bRows [][]string
+	for _, party := range ret.B2B {
+		for _, inv := range party.Inv {
+			b2bRows = append(b2bRows, []string{
+				party.CTIN, inv.receiverName, inv.Inum, csvDate(inv.Idt), amount(inv.Val),
+				stateLabel(inv.POS), inv.Rchrg, "", "Regular B2B", "",
+				amount(gstRate), amount(inv.Itms[0].ItmDet.Txval), amount(0),
+			})
+		}
+	}
+
+	var b2clRows [][]string
+	for _, group := range ret.B2CL {
+		for _, inv := range group.Inv {
+			b2clRows = append(b2clRows, []string{
+				inv.Inum, csvDate(inv.Idt), amount(inv.Val), stateLabel(group.POS), "",
+				amount(gstRate), amount(inv.Itms[0].ItmDet.Txval), amount(0), "",
+			})
+		}
+	}
+
+	var b2csRows [][]string
+	for _, row := range ret.B2CS {
+		b2csRows = append(b2csRows, []string{
+			row.Typ, stateLabel(row.POS), "", amount(row.Rt), amount(row.Txval), amount(0), "",
+		})
+	}
+
+	var hsnRows [][]string
+	for _, row := range ret.HSN.Data {
+		hsnRows = append(hsnRows, []string{
+			row.HsnSc, row.Desc, row.Uqc, amount(row.Qty), amount(row.Val), amount(row.Txval),
+			amount(row.Iamt), amount(row.Camt), amount(row.Samt), amount(row.Csamt),
+		})
+	}
+
+	sheets := []struct {
+		name   string
+		header []string
+		rows   [][]string
+	}{
+		{"b2b.csv", []string{"GSTIN/UIN of Recipient", "Receiver Name", "Invoice Number", "Invoice date",
+			"Invoice Value", "Place Of Supply", "Reverse Charge", "Applicable % of Tax Rate", "Invoice Type",
+			"E-Commerce GSTIN", "Rate", "Taxable Value", "Cess Amount"}, b2bRows},
+		{"b2cl.csv", []string{"Invoice Number", "Invoice date", "Invoice Value", "Place Of Supply",
+			"Applicable % of Tax Rate", "Rate", "Taxable Value", "Cess Amount", "E-Commerce GSTIN"}, b2clRows},
+		{"b2cs.csv", []string{"Type", "Place Of Supply", "Applicable % of Tax Rate", "Rate", "Taxable Value",
+			"Cess Amount", "E-Commerce GSTIN"}, b2csRows},
+		{"hsn.csv", []string{"HSN", "Description", "UQC", "Total Quantity", "Total Value", "Taxable Value",
+			"Integrated Tax Amount", "Central Tax Amount", "State/UT Tax Amount", "Cess Amount"}, hsnRows},
+	}
+	for _, sheet := range sheets {
+		if err := writeCSV(filepath.Join(dir, sheet.name), sheet.header, sheet.rows); err != nil {
+			return "", errs, err
+		}
+	}
+
+	if len(errs) > 0 {
+		report := strings.Join(errs, "\n") + "\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "validation_errors.txt"), []byte(report), 0644); err != nil {
+			return "", errs, err
+		}
+	}
+
+	return dir, errs, nil
+}
+
+func writeCSV(filename string, header []string, rows [][]string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func showGSTR1ExportWindow(myApp fyne.App, billDB *BillDB) {
+	window := myApp.NewWindow("GSTR-1 Export")
+
+	now := time.Now()
+	monthSelect := widget.NewSelect(months(), nil)
+	monthSelect.SetSelected(now.Month().String())
+
+	years := make([]string, 5)
+	for i := range years {
+		years[i] = fmt.Sprintf("%d", now.Year()-i)
+	}
+	yearSelect := widget.NewSelect(years, nil)
+	yearSelect.SetSelected(years[0])
+
+	errorsGrid := widget.NewTextGrid()
+	statusLabel := widget.NewLabel("")
+
+	exportButton := widget.NewButton("Export", func() {
+		year, _ := strconv.Atoi(yearSelect.Selected)
+		month := time.Month(getMonthNumber(monthSelect.Selected))
+
+		dir, errs, err := exportGSTR1(billDB.getBills(), year, month)
+		if err != nil {
+			statusLabel.SetText("Error exporting GSTR-1: " + err.Error())
+			return
+		}
+
+		if len(errs) == 0 {
+			errorsGrid.SetText("")
+			statusLabel.SetText("GSTR-1 exported to " + dir)
+			return
+		}
+		errorsGrid.SetText("Bills left out of the return:\n" + strings.Join(errs, "\n"))
+		statusLabel.SetText(fmt.Sprintf("GSTR-1 exported to %s with %d validation error(s)", dir, len(errs)))
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("Return Period:"),
+		container.NewGridWithColumns(2, monthSelect, yearSelect),
+		exportButton,
+		statusLabel,
+		errorsGrid,
+	)
+
+	window.SetContent(container.NewPadded(content))
+	window.Resize(fyne.NewSize(500, 400))
+	window.Show()
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	ageBandAdult  = "Adult (18+)"
+	ageBandChild  = "Child (5-17)"
+	ageBandInfant = "Child (under 5)"
+)
+
+var ageBands = []string{ageBandAdult, ageBandChild, ageBandInfant}
+
+var guestRelations = []string{
+	"Spouse", "Child", "Parent", "Sibling", "Relative", "Friend", "Colleague", "Other",
+}
+
+// StayGuest is an occupant sharing the stay with the billed customer. The
+// police require ID details of every adult occupant, and the FRRO the
+// passport and Form C details of every foreign national, whatever their age.
+type StayGuest struct {
+	Name           string          `json:"name"`
+	AgeBand        string          `json:"age_band"`
+	Relation       string          `json:"relation"`
+	GovIDType      string          `json:"gov_id_type,omitempty"`
+	GovIDNumber    string          `json:"gov_id_number,omitempty"`
+	GovIDPhotoPath string          `json:"gov_id_photo_path,omitempty"`
+	Nationality    string          `json:"nationality,omitempty"`
+	Foreign        *ForeignDetails `json:"foreign,omitempty"`
+}
+
+func (g StayGuest) adult() bool {
+	return g.AgeBand == ageBandAdult
+}
+
+func (g StayGuest) nationality() string {
+	if g.Nationality == "" {
+		return "Indian"
+	}
+	return g.Nationality
+}
+
+func (g StayGuest) label() string {
+	text := fmt.Sprintf("%s - %s, %s", g.Name, g.AgeBand, g.Relation)
+	if g.Foreign != nil {
+		text += ", " + g.nationality()
+	}
+	if g.GovIDType != "" {
+		text += fmt.Sprintf(" (%s %s)", g.GovIDType, loadSettings().maskGovID(g.GovIDType, g.GovIDNumber))
+	}
+	return text
+}
+
+// guestCounts returns the adults and children on the stay, counting the
+// billed customer as an adult
+func guestCounts(guests []StayGuest) (adults, children int) {
+	adults = 1
+	for _, g := range guests {
+		if g.adult() {
+			adults++
+		} else {
+			children++
+		}
+	}
+	return adults, children
+}
+
+func validateStayGuest(g StayGuest) error {
+	if strings.TrimSpace(g.Name) == "" {
+		return fmt.Errorf("please enter the guest's name")
+	}
+	if !slices.Contains(ageBands, g.AgeBand) {
+		return fmt.Errorf("please select the age band of %s", g.Name)
+	}
+	if !slices.Contains(guestRelations, g.Relation) {
+		return fmt.Errorf("please select the relation of %s to the customer", g.Name)
+	}
+	if g.Foreign != nil {
+		if err := validateForeignNational(g.Nationality, g.GovIDType, g.GovIDNumber, g.Foreign); err != nil {
+			return fmt.Errorf("%s: %v", g.Name, err)
+		}
+		return nil
+	}
+	if foreignNationality(g.Nationality) {
+		return fmt.Errorf("please enter the Form C details of %s", g.Name)
+	}
+	if g.adult() && g.GovIDType == "" {
+		return fmt.Errorf("please select the ID type of %s", g.Name)
+	}
+	if g.adult() || g.GovIDNumber != "" {
+		if err := validateGovID(g.GovIDType, g.GovIDNumber); err != nil {
+			return fmt.Errorf("%s: ID number: %v", g.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateStayGuests checks each guest and that the guest list agrees with
+// the number of adults and children on the bill
+func validateStayGuests(bill Bill) error {
+	if len(bill.Guests) == 0 {
+		return nil
+	}
+	for i, g := range bill.Guests {
+		if err := validateStayGuest(g); err != nil {
+			return fmt.Errorf("guest %d: %v", i+1, err)
+		}
+	}
+	adults, children := guestCounts(bill.Guests)
+	if adults != bill.Adults || children != bill.Children {
+		return fmt.Errorf("guest list has %d adults and %d children including the customer, but the bill has %d and %d",
+			adults, children, bill.Adults, bill.Children)
+	}
+	return nil
+}
+
+// maskGuests returns a copy of the guests with ID numbers masked
+func (s Settings) maskGuests(guests []StayGuest) []StayGuest {
+	var masked []StayGuest
+	for _, g := range guests {
+		if g.GovIDNumber != "" {
+			g.GovIDNumber = s.maskGovID(g.GovIDType, g.GovIDNumber)
+		}
+		masked = append(masked, g)
+	}
+	return masked
+}
+
+// guestListEditor captures the other occupants of a stay in the Create Bill
+// window. onChanged is called with the new list after every change.
+type guestListEditor struct {
+	guests    []StayGuest
+	content   fyne.CanvasObject
+	list      *widget.List
+	onChanged func(guests []StayGuest)
+}
+
+func newGuestListEditor(window fyne.Window, onChanged func(guests []StayGuest)) *guestListEditor {
+	e := &guestListEditor{onChanged: onChanged}
+
+	selected := -1
+	e.list = widget.NewList(
+		func() int { return len(e.guests) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(fmt.Sprintf("%d. %s", i+1, e.guests[i].label()))
+		},
+	)
+	e.list.OnSelected = func(i widget.ListItemID) {
+		selected = i
+	}
+
+	addButton := widget.NewButton("Add Guest", func() {
+		showStayGuestDialog(window, func(g StayGuest) {
+			e.setGuests(append(e.guests, g))
+		})
+	})
+	removeButton := widget.NewButton("Remove Selected Guest", func() {
+		if selected < 0 || selected >= len(e.guests) {
+			return
+		}
+		guests := append([]StayGuest{}, e.guests[:selected]...)
+		e.setGuests(append(guests, e.guests[selected+1:]...))
+		selected = -1
+		e.list.UnselectAll()
+	})
+
+	listBox := container.NewGridWrap(fyne.NewSize(460, 110), e.list)
+	e.content = container.NewVBox(listBox, container.NewGridWithColumns(2, addButton, removeButton))
+	return e
+}
+
+func (e *guestListEditor) setGuests(guests []StayGuest) {
+	e.guests = guests
+	e.list.Refresh()
+	if e.onChanged != nil {
+		e.onChanged(guests)
+	}
+}
+
+// showStayGuestDialog asks for one guest's details
+func showStayGuestDialog(window fyne.Window, onAdd func(StayGuest)) {
+	nameEntry := widget.NewEntry()
+	ageBandSelect := widget.NewSelect(ageBands, nil)
+	ageBandSelect.SetSelected(ageBandAdult)
+	relationSelect := widget.NewSelect(guestRelations, nil)
+
+	idTypeSelect := widget.NewSelect(govIDTypes, nil)
+	nationalityEntry := widget.NewEntry()
+	nationalityEntry.SetText("Indian")
+
+	// Foreign nationals give their passport and the Form C details
+	foreignForm := newForeignDetailsForm()
+	foreignForm.content.Hide()
+	var foreignCheck *widget.Check
+
+	idNumberEntry := widget.NewEntry()
+	idNumberEntry.Validator = func(text string) error {
+		if idTypeSelect.Selected == "" || text == "" {
+			return nil
+		}
+		if foreignCheck.Checked {
+			return validateForeignPassport(text)
+		}
+		return validateGovID(idTypeSelect.Selected, text)
+	}
+	idTypeSelect.OnChanged = func(idType string) {
+		idNumberEntry.SetPlaceHolder(govIDHints[idType])
+		idNumberEntry.Validate()
+	}
+
+	var d dialog.Dialog
+	foreignCheck = widget.NewCheck("Foreign National", func(foreign bool) {
+		if foreign {
+			idTypeSelect.SetSelected("Passport")
+			idTypeSelect.Disable()
+			idNumberEntry.SetPlaceHolder("Passport Number")
+			nationalityEntry.SetText("")
+			foreignForm.content.Show()
+			d.Resize(fyne.NewSize(450, 700))
+		} else {
+			idTypeSelect.Enable()
+			nationalityEntry.SetText("Indian")
+			foreignForm.reset()
+			foreignForm.content.Hide()
+		}
+		idNumberEntry.Validate()
+	})
+
+	var photoPath string
+	photoLabel := widget.NewLabel("No photo selected")
+	photoButton := widget.NewButton("Upload ID Photo", func() {
+		uploadIDPhoto(window, func(path string) {
+			photoPath = path
+			photoLabel.SetText("Photo selected: " + filepath.Base(path))
+		})
+	})
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("Age Band", ageBandSelect),
+		widget.NewFormItem("Relation", relationSelect),
+		widget.NewFormItem("Nationality", container.NewVBox(foreignCheck, nationalityEntry)),
+		widget.NewFormItem("ID Type", idTypeSelect),
+		widget.NewFormItem("ID Number", idNumberEntry),
+		widget.NewFormItem("", foreignForm.content),
+		widget.NewFormItem("ID Photo", container.NewVBox(photoButton, photoLabel)),
+	}
+
+	d = dialog.NewForm("Add Guest", "Add", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		g := StayGuest{
+			Name:           strings.TrimSpace(nameEntry.Text),
+			AgeBand:        ageBandSelect.Selected,
+			Relation:       relationSelect.Selected,
+			GovIDType:      idTypeSelect.Selected,
+			GovIDNumber:    normalizeGovID(idNumberEntry.Text),
+			GovIDPhotoPath: photoPath,
+			Nationality:    strings.TrimSpace(nationalityEntry.Text),
+		}
+		if foreignCheck.Checked {
+			foreign, err := foreignForm.details()
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			g.Foreign = foreign
+		}
+		if g.GovIDNumber == "" {
+			g.GovIDType = ""
+		}
+		if err := validateStayGuest(g); err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		if g.adult() && g.GovIDPhotoPath == "" {
+			dialog.ShowError(fmt.Errorf("please upload the ID photo of %s", g.Name), window)
+			return
+		}
+		onAdd(g)
+	}, window)
+	d.Resize(fyne.NewSize(450, 450))
+	d.Show()
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+)
+
+// ID photos are stored as JPEG no larger than this on either side
+const (
+	idPhotoMaxSide = 1600
+	idPhotoQuality = 80
+	// Larger images are refused rather than decoded into memory
+	idPhotoMaxPixels = 50000000
+)
+
+// processIDPhoto checks that an upload is a JPEG or PNG image, turns it
+// upright, crops the scanner background, scales it down and re-encodes it
+// as JPEG
+func processIDPhoto(data []byte) ([]byte, error) {
+	img, err := decodeIDPhoto(data)
+	if err != nil {
+		return nil, err
+	}
+	return encodeIDPhoto(img)
+}
+
+func decodeIDPhoto(data []byte) (*image.RGBA, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, fmt.Errorf("ID photo must be a JPEG or PNG image, not %s", contentType)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ID photo: %v", err)
+	}
+	if int64(config.Width)*int64(config.Height) > idPhotoMaxPixels {
+		return nil, fmt.Errorf("ID photo is too large (%dx%d)", config.Width, config.Height)
+	}
+	img, err := decodeRGBA(data)
+	if err != nil {
+		return nil, err
+	}
+	if contentType == "image/jpeg" {
+		img = orientImage(img, exifOrientation(data))
+	}
+	return scaleToFit(trimBackground(img), idPhotoMaxSide), nil
+}
+
+func decodeRGBA(data []byte) (*image.RGBA, error) {
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ID photo: %v", err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	return img, nil
+}
+
+func encodeIDPhoto(img image.Image) ([]byte, error) {
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: idPhotoQuality}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// combineIDPhotos puts the back of an ID card below the front, both
+// already processed, and scales the result back to the standard size
+func combineIDPhotos(front, back []byte) ([]byte, error) {
+	frontImg, err := decodeRGBA(front)
+	if err != nil {
+		return nil, err
+	}
+	backImg, err := decodeRGBA(back)
+	if err != nil {
+		return nil, err
+	}
+
+	// Both sides are shown at the width of the narrower one
+	width := frontImg.Bounds().Dx()
+	if w := backImg.Bounds().Dx(); w < width {
+		width = w
+	}
+	frontImg = scaleToWidth(frontImg, width)
+	backImg = scaleToWidth(backImg, width)
+
+	const gap = 16
+	height := frontImg.Bounds().Dy() + gap + backImg.Bounds().Dy()
+	combined := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(combined, combined.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(combined, frontImg.Bounds(), frontImg, image.Point{}, draw.Src)
+	backRect := backImg.Bounds().Add(image.Pt(0, frontImg.Bounds().Dy()+gap))
+	draw.Draw(combined, backRect, backImg, image.Point{}, draw.Src)
+	return encodeIDPhoto(scaleToFit(combined, idPhotoMaxSide))
+}
+
+// exifOrientation returns the EXIF orientation of a JPEG, 1 if it has none
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		// Image data starts at the start of scan marker
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(segment) > 14 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of the TIFF
+// structure inside an EXIF segment
+func tiffOrientation(tiff []byte) int {
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// orientImage turns an image upright according to its EXIF orientation
+func orientImage(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// trimBackground crops the even border left around a card by a flatbed
+// scanner, judged by the colour of the top left corner
+func trimBackground(img *image.RGBA) *image.RGBA {
+	const (
+		tolerance = 40
+		margin    = 10
+	)
+	b := img.Bounds()
+	bg := img.Pix[0:4]
+	differs := func(x, y int) bool {
+		p := img.Pix[img.PixOffset(x, y):]
+		for c := 0; c < 3; c++ {
+			d := int(p[c]) - int(bg[c])
+			if d > tolerance || d < -tolerance {
+				return true
+			}
+		}
+		return false
+	}
+	// A line is background if under 1% of its pixels differ, allowing for
+	// dust and noise
+	rowIsBackground := func(y int) bool {
+		n := 0
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if differs(x, y) {
+				n++
+			}
+		}
+		return n*100 < b.Dx()
+	}
+	colIsBackground := func(x int) bool {
+		n := 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			if differs(x, y) {
+				n++
+			}
+		}
+		return n*100 < b.Dy()
+	}
+
+	top, bottom, left, right := b.Min.Y, b.Max.Y, b.Min.X, b.Max.X
+	for top < bottom && rowIsBackground(top) {
+		top++
+	}
+	for bottom > top && rowIsBackground(bottom-1) {
+		bottom--
+	}
+	for left < right && colIsBackground(left) {
+		left++
+	}
+	for right > left && colIsBackground(right-1) {
+		right--
+	}
+
+	crop := image.Rect(left-margin, top-margin, right+margin, bottom+margin).Intersect(b)
+	// Keep photos that are mostly plain, or already cropped, as they are
+	if crop.Dx() < 100 || crop.Dy() < 100 || crop.Dx()*crop.Dy()*10 < b.Dx()*b.Dy() || crop == b {
+		return img
+	}
+	out := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(out, out.Bounds(), img, crop.Min, draw.Src)
+	return out
+}
+
+// scaleToFit scales an image down so neither side is longer than maxSide
+func scaleToFit(img *image.RGBA, maxSide int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+	if w >= h {
+		return scaleDown(img, maxSide, h*maxSide/w)
+	}
+	return scaleDown(img, w*maxSide/h, maxSide)
+}
+
+func scaleToWidth(img *image.RGBA, width int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= width {
+		return img
+	}
+	return scaleDown(img, width, h*width/w)
+}
+
+// scaleDown shrinks an image by averaging the source pixels under each
+// destination pixel
+func scaleDown(src *image.RGBA, dw, dh int) *image.RGBA {
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				p := src.Pix[src.PixOffset(x0, sy):]
+				for i := 0; i < (x1-x0)*4; i++ {
+					sum[i%4] += int(p[i])
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			d := dst.Pix[dst.PixOffset(x, y):]
+			for c := 0; c < 4; c++ {
+				d[c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
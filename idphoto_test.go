@@ -0,0 +1,24 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestCombineIDPhotosKeepsStandardSize(t *testing.T) {
+	side, err := encodeIDPhoto(image.NewRGBA(image.Rect(0, 0, idPhotoMaxSide, 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := combineIDPhotos(side, side)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := decodeRGBA(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() > idPhotoMaxSide || b.Dy() > idPhotoMaxSide {
+		t.Errorf("combined photo is %dx%d, want at most %d on either side", b.Dx(), b.Dy(), idPhotoMaxSide)
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/boombuler/barcode/qr"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/jung-kurt/gofpdf/contrib/barcode"
+)
+
+// invoiceRenderer lays out a bill as a PDF document
+type invoiceRenderer interface {
+	Render(bill Bill) (*gofpdf.Fpdf, error)
+}
+
+// templateRenderer draws the sections listed in an InvoiceTemplate. The
+// section code is written against the A4 design (190mm content width, 10pt
+// text) and scaled to the template's page and font size.
+type templateRenderer struct {
+	tmpl     InvoiceTemplate
+	settings Settings
+	pdf      *gofpdf.Fpdf
+	bill     Bill
+	left     float64
+	scale    float64
+	fs       float64
+}
+
+// invoiceSections maps the section names usable in templates to their drawing code
+var invoiceSections = map[string]func(r *templateRenderer){
+	"header":      (*templateRenderer).drawHeader,
+	"e_invoice":   (*templateRenderer).drawEInvoice,
+	"separator":   (*templateRenderer).drawSeparator,
+	"details":     (*templateRenderer).drawDetails,
+	"bill_to":     (*templateRenderer).drawBillTo,
+	"guests":      (*templateRenderer).drawGuests,
+	"address":     (*templateRenderer).drawAddress,
+	"items":       (*templateRenderer).drawItems,
+	"tax_breakup": (*templateRenderer).drawTaxBreakup,
+	"totals":      (*templateRenderer).drawTotals,
+	"terms":       (*templateRenderer).drawTerms,
+	"signature":   (*templateRenderer).drawSignature,
+	"guest_list":  (*templateRenderer).drawGuestList,
+	"id_photo":    (*templateRenderer).drawIDPhoto,
+	"reg_card":    (*templateRenderer).drawRegistration,
+	"page_number": (*templateRenderer).drawPageNumber,
+}
+
+func newTemplateRenderer(tmpl InvoiceTemplate, settings Settings) *templateRenderer {
+	return &templateRenderer{tmpl: tmpl, settings: settings}
+}
+
+func (r *templateRenderer) Render(bill Bill) (*gofpdf.Fpdf, error) {
+	if err := validateTemplate(r.tmpl); err != nil {
+		return nil, fmt.Errorf("invalid invoice template %s: %v", r.tmpl.Name, err)
+	}
+
+	r.bill = bill
+	r.pdf = gofpdf.New(r.tmpl.Orientation, "mm", r.tmpl.PageSize, "")
+	pageW, _ := r.pdf.GetPageSize()
+	r.left = 10
+	r.scale = (pageW - 2*r.left) / 190
+	r.fs = r.tmpl.FontSize
+
+	r.pdf.AddPage()
+	r.pdf.SetTextColor(r.tmpl.TextColor[0], r.tmpl.TextColor[1], r.tmpl.TextColor[2])
+	for _, section := range r.tmpl.Sections {
+		invoiceSections[section](r)
+	}
+	return r.pdf, r.pdf.Error()
+}
+
+// x maps an x coordinate of the A4 design onto the page
+func (r *templateRenderer) x(v float64) float64 {
+	return r.left + (v-10)*r.scale
+}
+
+// w scales a width of the A4 design
+func (r *templateRenderer) w(v float64) float64 {
+	return v * r.scale
+}
+
+// h scales a line height with the template font size
+func (r *templateRenderer) h(v float64) float64 {
+	return v * r.fs / 10
+}
+
+func (r *templateRenderer) font(style string, size float64) {
+	r.pdf.SetFont(r.tmpl.FontFamily, style, size*r.fs/10)
+}
+
+func (r *templateRenderer) fill() {
+	r.pdf.SetFillColor(r.tmpl.FillColor[0], r.tmpl.FillColor[1], r.tmpl.FillColor[2])
+}
+
+// field prints a "label value" pair with the value in bold
+func (r *templateRenderer) field(x, labelW, valueW, height float64, label, value string) {
+	pdf := r.pdf
+	pdf.SetX(r.x(x))
+	r.font("", 10)
+	pdf.Cell(r.w(labelW), r.h(height), label)
+	r.font("B", 10)
+	pdf.Cell(r.w(valueW), r.h(height), value)
+	pdf.Ln(r.h(height))
+}
+
+func (r *templateRenderer) drawHeader() {
+	pdf := r.pdf
+	tmpl := r.tmpl
+
+	if tmpl.Title != "" {
+		r.font("B", 14)
+		pdf.CellFormat(r.w(190), r.h(8), tmpl.Title, "", 1, "C", false, 0, "")
+	}
+
+	// Logo to the left of the property name
+	textX := r.left
+	if tmpl.Logo != "" {
+		if _, err := os.Stat(tmpl.Logo); err == nil {
+			logoH := r.h(20)
+			info := pdf.RegisterImageOptions(tmpl.Logo, gofpdf.ImageOptions{ReadDpi: true})
+			if info != nil && info.Height() > 0 {
+				logoW := logoH * info.Width() / info.Height()
+				pdf.ImageOptions(tmpl.Logo, r.left, pdf.GetY(), logoW, logoH, false, gofpdf.ImageOptions{ReadDpi: true}, 0, "")
+				textX += logoW + 5
+			}
+		}
+	}
+
+	pdf.SetX(textX)
+	pdf.SetTextColor(tmpl.AccentColor[0], tmpl.AccentColor[1], tmpl.AccentColor[2])
+	r.font("B", 20)
+	pdf.Cell(r.w(190), r.h(10), tmpl.label("property_name"))
+	pdf.SetTextColor(tmpl.TextColor[0], tmpl.TextColor[1], tmpl.TextColor[2])
+	pdf.Ln(r.h(8))
+
+	r.font("", 10)
+	for _, key := range []string{"property_address", "property_phone", "property_gstin"} {
+		pdf.SetX(textX)
+		pdf.Cell(r.w(190), r.h(5), tmpl.label(key))
+		pdf.Ln(r.h(5))
+	}
+	pdf.Ln(r.h(10))
+}
+
+// drawEInvoice prints the IRN details and the IRP signed QR code
+func (r *templateRenderer) drawEInvoice() {
+	pdf := r.pdf
+	bill := r.bill
+	if bill.EInvoice == nil {
+		return
+	}
+
+	qrKey := barcode.RegisterQR(pdf, bill.EInvoice.SignedQRCode, qr.M, qr.Unicode)
+	barcode.Barcode(pdf, qrKey, r.x(165), 8, r.w(32), r.w(32), false)
+
+	pdf.SetY(pdf.GetY() - r.h(10))
+	r.font("", 8)
+	pdf.Cell(r.w(15), r.h(4), "IRN:")
+	pdf.Cell(r.w(140), r.h(4), bill.EInvoice.Irn)
+	pdf.Ln(r.h(4))
+	pdf.Cell(r.w(15), r.h(4), "Ack No:")
+	pdf.Cell(r.w(50), r.h(4), fmt.Sprintf("%d", bill.EInvoice.AckNo))
+	pdf.Cell(r.w(15), r.h(4), "Ack Date:")
+	pdf.Cell(r.w(50), r.h(4), bill.EInvoice.AckDt)
+	pdf.Ln(r.h(10))
+}
+
+func (r *templateRenderer) drawSeparator() {
+	pdf := r.pdf
+	pdf.Line(r.x(10), pdf.GetY(), r.x(200), pdf.GetY())
+	pdf.Ln(r.h(5))
+}
+
+// drawDetails prints the bill and customer boxes side by side
+func (r *templateRenderer) drawDetails() {
+	pdf := r.pdf
+	bill := r.bill
+
+	// Bill Details in a box
+	r.fill()
+	r.font("B", 12)
+
+	// Create a box for Bill Details
+	startY := pdf.GetY()
+	pdf.Rect(r.x(10), startY, r.w(90), r.h(8), "F")
+	pdf.Cell(r.w(90), r.h(8), r.tmpl.label("bill_details"))
+
+	// Create a box for Customer Details
+	pdf.Rect(r.x(105), startY, r.w(90), r.h(8), "F")
+	pdf.Cell(r.w(5), r.h(8), "") // spacing
+	pdf.Cell(r.w(90), r.h(8), r.tmpl.label("customer_details"))
+	pdf.Ln(r.h(10))
+
+	// Left side - Bill details with borders
+	startY = pdf.GetY()
+	pdf.Rect(r.x(10), startY, r.w(90), r.h(24), "D")
+	r.field(15, 25, 60, 6, "Bill No:", bill.BillNumber)
+	r.field(15, 25, 60, 6, "Date:", bill.Date.Format("02-01-2006"))
+	r.field(15, 25, 60, 6, "GSTIN:", sellerGSTIN)
+
+	// Right side - Customer details with borders
+	pdf.Rect(r.x(105), startY, r.w(90), r.h(40), "D")
+	pdf.SetY(startY)
+	r.field(110, 25, 60, 6, "Name:", bill.Customer.Name)
+	r.field(110, 25, 60, 6, "Phone:", bill.Customer.Phone)
+	r.field(110, 25, 60, 6, "ID Type:", bill.Customer.GovIDType)
+	r.field(110, 25, 60, 6, "ID No:", r.settings.maskGovID(bill.Customer.GovIDType, bill.Customer.GovIDNumber))
+
+	// Move to the maximum Y position used
+	pdf.SetY(math.Max(pdf.GetY(), startY+r.h(45)))
+	pdf.Ln(r.h(5))
+}
+
+// drawBillTo prints the company block for invoices raised on a company
+func (r *templateRenderer) drawBillTo() {
+	pdf := r.pdf
+	company := r.bill.BillTo
+	if company == nil {
+		return
+	}
+
+	r.fill()
+	r.font("B", 12)
+	pdf.Rect(r.x(10), pdf.GetY(), r.w(185), r.h(8), "F")
+	pdf.SetX(r.x(15))
+	pdf.Cell(r.w(180), r.h(8), r.tmpl.label("bill_to"))
+	pdf.Ln(r.h(10))
+
+	startY := pdf.GetY()
+	r.field(15, 25, 150, 6, "Company:", company.LegalName)
+	r.field(15, 25, 150, 6, "GSTIN:", company.GSTIN)
+	r.field(15, 25, 150, 6, "State:", fmt.Sprintf("%s (Code %s)", gstStates[company.StateCode], company.StateCode))
+	pdf.SetX(r.x(15))
+	r.font("", 10)
+	pdf.Cell(r.w(25), r.h(6), "Address:")
+	r.font("B", 10)
+	pdf.MultiCell(r.w(150), r.h(6), company.Address, "", "", false)
+	pdf.Rect(r.x(10), startY, r.w(185), pdf.GetY()-startY, "D")
+	pdf.Ln(r.h(5))
+}
+
+// drawGuests prints the guest count with a light background
+func (r *templateRenderer) drawGuests() {
+	pdf := r.pdf
+	r.fill()
+	pdf.Rect(r.x(10), pdf.GetY(), r.w(185), r.h(8), "F")
+	pdf.SetX(r.x(15))
+	r.font("", 10)
+	pdf.Cell(r.w(50), r.h(8), r.tmpl.label("guests"))
+	r.font("B", 10)
+	pdf.Cell(r.w(130), r.h(8), fmt.Sprintf("%d Adults, %d Children", r.bill.Adults, r.bill.Children))
+	pdf.Ln(r.h(12))
+}
+
+// drawAddress prints the customer address with a light background
+func (r *templateRenderer) drawAddress() {
+	pdf := r.pdf
+	r.fill()
+	pdf.Rect(r.x(10), pdf.GetY(), r.w(185), r.h(8), "F")
+	pdf.SetX(r.x(15))
+	r.font("", 10)
+	pdf.Cell(r.w(50), r.h(8), r.tmpl.label("address"))
+	r.font("B", 10)
+	// Handle multi-line address
+	pdf.SetX(r.x(65))
+	pdf.MultiCell(r.w(130), r.h(8), r.bill.Customer.Address, "", "", false)
+	pdf.Ln(r.h(4))
+}
+
+func (r *templateRenderer) drawItems() {
+	pdf := r.pdf
+	tmpl := r.tmpl
+
+	// Table headers with filled background
+	r.fill()
+	r.font("B", 10)
+	pdf.CellFormat(r.w(45), r.h(8), tmpl.label("room_type"), "1", 0, "", true, 0, "")
+	pdf.CellFormat(r.w(30), r.h(8), tmpl.label("rate"), "1", 0, "", true, 0, "")
+	pdf.CellFormat(r.w(20), r.h(8), tmpl.label("days"), "1", 0, "", true, 0, "")
+	pdf.CellFormat(r.w(55), r.h(8), tmpl.label("period"), "1", 0, "", true, 0, "")
+	pdf.CellFormat(r.w(40), r.h(8), tmpl.label("amount"), "1", 1, "", true, 0, "")
+
+	r.font("", 10)
+	for _, item := range r.bill.Items {
+		amount := item.Rate * float64(item.Days)
+		period := fmt.Sprintf("%s to %s",
+			item.FromDate.Format("02/01/06"), item.ToDate.Format("02/01/06"))
+
+		pdf.CellFormat(r.w(45), r.h(8), item.Description, "1", 0, "", false, 0, "")
+		pdf.CellFormat(r.w(30), r.h(8), fmt.Sprintf("₹%.2f", item.Rate), "1", 0, "", false, 0, "")
+		pdf.CellFormat(r.w(20), r.h(8), fmt.Sprintf("%d", item.Days), "1", 0, "", false, 0, "")
+		pdf.CellFormat(r.w(55), r.h(8), period, "1", 0, "", false, 0, "")
+		pdf.CellFormat(r.w(40), r.h(8), fmt.Sprintf("₹%.2f", amount), "1", 1, "", false, 0, "")
+	}
+}
+
+// drawTaxBreakup prints the SAC-wise CGST/SGST/IGST split of every room line
+func (r *templateRenderer) drawTaxBreakup() {
+	pdf := r.pdf
+	bill := r.bill
+	tmpl := r.tmpl
+
+	pdf.Ln(r.h(5))
+	r.font("B", 10)
+	pdf.Cell(r.w(60), r.h(6), tmpl.label("tax_breakup"))
+	r.font("", 10)
+	pdf.Cell(r.w(35), r.h(6), tmpl.label("place_of_supply"))
+	r.font("B", 10)
+	pdf.Cell(r.w(95), r.h(6), stateLabel(bill.PlaceOfSupply))
+	pdf.Ln(r.h(8))
+
+	widths := []float64{30, 35, 30, 30, 30, 35}
+	headers := []string{"SAC", "Taxable Value", "CGST", "SGST", "IGST", "Total"}
+	r.fill()
+	for i, header := range headers {
+		ln := 0
+		if i == len(headers)-1 {
+			ln = 1
+		}
+		pdf.CellFormat(r.w(widths[i]), r.h(8), header, "1", ln, "C", true, 0, "")
+	}
+
+	r.font("", 10)
+	for _, item := range bill.Items {
+		line := taxSplit(item.Rate*float64(item.Days), bill.isInterState())
+		values := []string{
+			sacAccommodation,
+			fmt.Sprintf("%.2f", line.Taxable),
+			fmt.Sprintf("%.2f", line.CGST),
+			fmt.Sprintf("%.2f", line.SGST),
+			fmt.Sprintf("%.2f", line.IGST),
+			fmt.Sprintf("%.2f", line.Total),
+		}
+		for i, value := range values {
+			ln := 0
+			if i == len(values)-1 {
+				ln = 1
+			}
+			pdf.CellFormat(r.w(widths[i]), r.h(8), value, "1", ln, "R", false, 0, "")
+		}
+	}
+}
+
+// drawTotals prints the right-aligned totals, payments and the UPI QR code
+func (r *templateRenderer) drawTotals() {
+	pdf := r.pdf
+	bill := r.bill
+	tmpl := r.tmpl
+	amounts := bill.amounts()
+
+	pdf.Ln(r.h(5))
+	// Add line separator
+	pdf.Line(r.x(10), pdf.GetY(), r.x(200), pdf.GetY())
+	pdf.Ln(r.h(5))
+	totalsY := pdf.GetY()
+
+	r.font("B", 10)
+	pdf.CellFormat(r.w(150), r.h(8), tmpl.label("subtotal"), "", 0, "R", false, 0, "")
+	pdf.CellFormat(r.w(40), r.h(8), fmt.Sprintf("₹%.2f", amounts.Taxable), "", 1, "R", false, 0, "")
+
+	pdf.CellFormat(r.w(150), r.h(8), tmpl.label("gst"), "", 0, "R", false, 0, "")
+	pdf.CellFormat(r.w(40), r.h(8), fmt.Sprintf("₹%.2f", amounts.Tax()), "", 1, "R", false, 0, "")
+
+	// Total amount with box
+	r.fill()
+	pdf.CellFormat(r.w(150), r.h(8), tmpl.label("total"), "1", 0, "R", true, 0, "")
+	pdf.CellFormat(r.w(40), r.h(8), fmt.Sprintf("₹%.2f", amounts.Total), "1", 1, "R", true, 0, "")
+
+	balance := bill.balance()
+	if len(bill.Payments) > 0 {
+		pdf.CellFormat(r.w(150), r.h(8), tmpl.label("advance"), "", 0, "R", false, 0, "")
+		pdf.CellFormat(r.w(40), r.h(8), fmt.Sprintf("₹%.2f", bill.paid()), "", 1, "R", false, 0, "")
+		pdf.CellFormat(r.w(150), r.h(8), tmpl.label("balance"), "1", 0, "R", true, 0, "")
+		pdf.CellFormat(r.w(40), r.h(8), fmt.Sprintf("₹%.2f", balance), "1", 1, "R", true, 0, "")
+	}
+
+	// UPI QR code for the balance, beside the totals
+	if r.settings.UPIVPA != "" && balance > 0 {
+		upiURI := upiPayURI(r.settings.UPIVPA, r.settings.UPIPayeeName, balance, bill.BillNumber)
+		upiKey := barcode.RegisterQR(pdf, upiURI, qr.M, qr.Unicode)
+		barcode.Barcode(pdf, upiKey, r.x(12), totalsY, r.w(30), r.w(30), false)
+
+		afterTotalsY := pdf.GetY()
+		pdf.SetXY(r.x(45), totalsY+r.h(8))
+		r.font("B", 9)
+		pdf.Cell(r.w(60), r.h(5), tmpl.label("upi"))
+		pdf.SetXY(r.x(45), totalsY+r.h(13))
+		r.font("", 8)
+		pdf.Cell(r.w(60), r.h(4), r.settings.UPIVPA)
+		pdf.SetXY(r.x(45), totalsY+r.h(17))
+		pdf.Cell(r.w(60), r.h(4), fmt.Sprintf("Amount: ₹%.2f", balance))
+		pdf.SetY(math.Max(afterTotalsY, totalsY+r.w(30)))
+	}
+	pdf.Ln(r.h(15))
+}
+
+func (r *templateRenderer) drawTerms() {
+	pdf := r.pdf
+	if len(r.tmpl.Terms) == 0 {
+		return
+	}
+
+	r.font("B", 10)
+	pdf.Cell(r.w(190), r.h(6), r.tmpl.label("terms"))
+	pdf.Ln(r.h(6))
+	r.font("", 8)
+	for _, term := range r.tmpl.Terms {
+		pdf.Cell(r.w(190), r.h(4), term)
+		pdf.Ln(r.h(4))
+	}
+}
+
+// drawSignature prints the signature line in the footer
+func (r *templateRenderer) drawSignature() {
+	pdf := r.pdf
+	pdf.Ln(r.h(10))
+	pdf.Line(r.x(140), pdf.GetY(), r.x(190), pdf.GetY())
+	pdf.Ln(r.h(3))
+	r.font("", 8)
+	pdf.SetX(r.x(140))
+	pdf.Cell(r.w(60), r.h(4), r.tmpl.label("signature"))
+}
+
+// drawGuestList prints every occupant of the stay on an annexure page,
+// starting with the billed customer
+func (r *templateRenderer) drawGuestList() {
+	pdf := r.pdf
+	tmpl := r.tmpl
+	bill := r.bill
+	if len(bill.Guests) == 0 {
+		return
+	}
+
+	pdf.AddPage()
+	r.font("B", 12)
+	pdf.Cell(r.w(190), r.h(8), fmt.Sprintf("%s - Bill No. %s", tmpl.label("guest_list"), bill.BillNumber))
+	pdf.Ln(r.h(10))
+	r.guestTable()
+}
+
+// guestTable prints a row for the billed customer and each other occupant
+func (r *templateRenderer) guestTable() {
+	pdf := r.pdf
+	tmpl := r.tmpl
+	bill := r.bill
+
+	widths := []float64{10, 50, 30, 25, 35, 40}
+	headers := []string{"#", tmpl.label("guest_name"), tmpl.label("age_band"), tmpl.label("relation"),
+		tmpl.label("id_type"), tmpl.label("id_number")}
+	r.fill()
+	r.font("B", 10)
+	for i, header := range headers {
+		pdf.CellFormat(r.w(widths[i]), r.h(8), header, "1", 0, "", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	rows := [][]string{{bill.Customer.Name, ageBandAdult, "Customer", bill.Customer.GovIDType,
+		r.settings.maskGovID(bill.Customer.GovIDType, bill.Customer.GovIDNumber)}}
+	for _, g := range r.settings.maskGuests(bill.Guests) {
+		rows = append(rows, []string{g.Name, g.AgeBand, g.Relation, g.GovIDType, g.GovIDNumber})
+	}
+
+	r.font("", 10)
+	for n, row := range rows {
+		pdf.CellFormat(r.w(widths[0]), r.h(8), fmt.Sprintf("%d", n+1), "1", 0, "", false, 0, "")
+		for i, value := range row {
+			pdf.CellFormat(r.w(widths[i+1]), r.h(8), value, "1", 0, "", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+// drawPageNumber numbers every page once the content is laid out
+func (r *templateRenderer) drawPageNumber() {
+	pdf := r.pdf
+	_, pageH := pdf.GetPageSize()
+	pdf.SetAutoPageBreak(false, 0)
+	r.font("I", 8)
+	for page := 1; page <= pdf.PageCount(); page++ {
+		pdf.SetPage(page)
+		pdf.SetXY(r.left, pageH-17)
+		pdf.Cell(0, 10, fmt.Sprintf("Page %d", page))
+	}
+	pdf.SetAutoPageBreak(true, 20)
+}
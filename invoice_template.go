@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// Custom invoice templates are JSON files placed in this directory, e.g.
+//
+//	{
+//	  "name": "Festive",
+//	  "base": "Classic A4",
+//	  "logo": "templates/logo.png",
+//	  "accent_color": [180, 30, 30],
+//	  "labels": {"terms": "House Rules:"},
+//	  "terms": ["1. Check-out time is 10:00 AM"]
+//	}
+//
+// Fields that are left out are taken from the base template.
+const templatesDir = "templates"
+
+// InvoiceTemplate declares how an invoice is laid out: page size, the
+// sections to draw in order, label text overrides, colors and logo.
+type InvoiceTemplate struct {
+	Name        string            `json:"name"`
+	Base        string            `json:"base,omitempty"`
+	PageSize    string            `json:"page_size"`
+	Orientation string            `json:"orientation"`
+	FontFamily  string            `json:"font_family"`
+	FontSize    float64           `json:"font_size"`
+	Title       string            `json:"title,omitempty"`
+	Logo        string            `json:"logo,omitempty"`
+	Sections    []string          `json:"sections"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	FillColor   [3]int            `json:"fill_color"`
+	TextColor   [3]int            `json:"text_color"`
+	AccentColor [3]int            `json:"accent_color"`
+	Terms       []string          `json:"terms,omitempty"`
+}
+
+var defaultTerms = []string{
+	"1. Check-in time is 12:00 PM and check-out time is 11:00 AM",
+	"2. Payment to be made in advance",
+	"3. No refunds for early check-out",
+	"4. ID proof is mandatory for all guests",
+	"5. Outside food is not allowed",
+	"6. Pets are not allowed",
+	"7. The management is not responsible for any valuables",
+	"8. Any damage to hotel property will be charged",
+}
+
+// defaultLabels holds the text printed for each label key unless a
+// template overrides it
+var defaultLabels = map[string]string{
+	"property_name":    sellerName,
+	"property_address": "123, Main Street, Chennai - 600001",
+	"property_phone":   "Phone: +91 98765 43210",
+	"property_gstin":   "GSTIN: " + sellerGSTIN,
+	"bill_details":     "Bill Details",
+	"customer_details": "Customer Details",
+	"bill_to":          "Bill To",
+	"guests":           "No. of Guests:",
+	"address":          "Address:",
+	"room_type":        "Room Type",
+	"rate":             "Rate/Day",
+	"days":             "Days",
+	"period":           "Period",
+	"amount":           "Amount",
+	"tax_breakup":      "Tax Breakup",
+	"place_of_supply":  "Place of Supply:",
+	"subtotal":         "Subtotal:",
+	"gst":              "GST (18%):",
+	"total":            "Total Amount:",
+	"advance":          "Amount Paid:",
+	"balance":          "Balance Due:",
+	"upi":              "Scan to pay via UPI",
+	"terms":            "Terms & Conditions:",
+	"signature":        "Authorized Signature",
+	"guest_list":       "Annexure: Guest List",
+	"guest_name":       "Name",
+	"age_band":         "Age Band",
+	"relation":         "Relation",
+	"id_type":          "ID Type",
+	"id_number":        "ID Number",
+	"reg_card":         "GUEST REGISTRATION CARD",
+	"id_photo":         "ID Proof",
+	"no_id_photo":      "ID photo not on file",
+	"id_photo_hidden":  "ID photo not shown",
+	"stay_guests":      "Guests on this Stay",
+	"declaration":      "I certify that the particulars given above are correct and that the ID proof shown is my own. I agree to abide by the terms of stay.",
+	"guest_sign":       "Guest Signature",
+	"desk_sign":        "Front Desk (Name & Signature)",
+}
+
+var builtinTemplates = []InvoiceTemplate{
+	{
+		Name:        "Classic A4",
+		PageSize:    "A4",
+		Orientation: "P",
+		FontFamily:  "Arial",
+		FontSize:    10,
+		Sections: []string{
+			"header", "e_invoice", "separator", "details", "bill_to", "guests",
+			"address", "separator", "items", "totals", "terms", "signature", "guest_list",
+			"page_number",
+		},
+		FillColor: [3]int{240, 240, 240},
+		Terms:     defaultTerms,
+	},
+	{
+		Name:        "Compact A5",
+		PageSize:    "A5",
+		Orientation: "P",
+		FontFamily:  "Arial",
+		FontSize:    8,
+		Sections: []string{
+			"header", "e_invoice", "separator", "details", "bill_to", "items",
+			"totals", "signature", "guest_list", "page_number",
+		},
+		FillColor: [3]int{240, 240, 240},
+	},
+	{
+		Name:        "Detailed Tax Invoice",
+		PageSize:    "A4",
+		Orientation: "P",
+		FontFamily:  "Arial",
+		FontSize:    10,
+		Title:       "TAX INVOICE",
+		Sections: []string{
+			"header", "e_invoice", "separator", "details", "bill_to", "guests",
+			"address", "separator", "items", "tax_breakup", "totals", "terms",
+			"signature", "guest_list", "page_number",
+		},
+		FillColor: [3]int{230, 236, 245},
+		Terms:     defaultTerms,
+	},
+}
+
+func (t InvoiceTemplate) label(key string) string {
+	if text, ok := t.Labels[key]; ok {
+		return text
+	}
+	return defaultLabels[key]
+}
+
+// availableTemplates returns the built-in templates followed by any valid
+// custom templates found in the templates directory
+func availableTemplates() []InvoiceTemplate {
+	templates := append([]InvoiceTemplate{}, builtinTemplates...)
+
+	files, _ := filepath.Glob(filepath.Join(templatesDir, "*.json"))
+	sort.Strings(files)
+	for _, file := range files {
+		tmpl, err := loadTemplateFile(file)
+		if err != nil {
+			continue
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates
+}
+
+// findTemplate returns the template with the given name, falling back to
+// the classic A4 layout
+func findTemplate(name string) InvoiceTemplate {
+	for _, tmpl := range availableTemplates() {
+		if tmpl.Name == name {
+			return tmpl
+		}
+	}
+	return builtinTemplates[0]
+}
+
+func loadTemplateFile(path string) (InvoiceTemplate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return InvoiceTemplate{}, err
+	}
+
+	var header struct {
+		Base string `json:"base"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return InvoiceTemplate{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	tmpl := builtinTemplates[0]
+	for _, b := range builtinTemplates {
+		if b.Name == header.Base {
+			tmpl = b
+		}
+	}
+	// Copy the base slices and labels; decoding into them in place would
+	// otherwise overwrite the built-in template
+	tmpl.Sections = append([]string{}, tmpl.Sections...)
+	tmpl.Terms = append([]string{}, tmpl.Terms...)
+	labels := make(map[string]string, len(tmpl.Labels))
+	for k, v := range tmpl.Labels {
+		labels[k] = v
+	}
+	tmpl.Labels = labels
+	tmpl.Name = ""
+
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		return InvoiceTemplate{}, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := validateTemplate(tmpl); err != nil {
+		return InvoiceTemplate{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return tmpl, nil
+}
+
+func validateTemplate(tmpl InvoiceTemplate) error {
+	if tmpl.Name == "" {
+		return fmt.Errorf("template name is missing")
+	}
+	if tmpl.PageSize != "A4" && tmpl.PageSize != "A5" {
+		return fmt.Errorf("unsupported page size %q", tmpl.PageSize)
+	}
+	if tmpl.Orientation != "P" && tmpl.Orientation != "L" {
+		return fmt.Errorf("orientation must be P or L")
+	}
+	if tmpl.FontSize < 6 || tmpl.FontSize > 14 {
+		return fmt.Errorf("font size must be between 6 and 14")
+	}
+	for _, section := range tmpl.Sections {
+		if _, ok := invoiceSections[section]; !ok {
+			return fmt.Errorf("unknown section %q", section)
+		}
+	}
+	return nil
+}
@@ -588,12 +588,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"math"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -602,41 +601,71 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
-	"github.com/jung-kurt/gofpdf"
 )
 
 type Customer struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	Address        string    `json:"address"`
-	Phone          string    `json:"phone"`
-	GovIDType      string    `json:"gov_id_type"`
-	GovIDNumber    string    `json:"gov_id_number"`
-	GovIDPhotoPath string    `json:"gov_id_photo_path"`
-	AddedOn        time.Time `json:"added_on"`
+	ID             string          `json:"id"`
+	Name           string          `json:"name"`
+	Address        string          `json:"address"`
+	Phone          string          `json:"phone"`
+	GovIDType      string          `json:"gov_id_type"`
+	GovIDNumber    string          `json:"gov_id_number"`
+	GovIDPhotoPath string          `json:"gov_id_photo_path"`
+	CompanyID      string          `json:"company_id,omitempty"`
+	Nationality    string          `json:"nationality,omitempty"`
+	Foreign        *ForeignDetails `json:"foreign,omitempty"`
+	Notes          string          `json:"notes,omitempty"`
+	AddedOn        time.Time       `json:"added_on"`
+	CreatedBy      string          `json:"created_by,omitempty"`
+}
+
+var govIDTypes = []string{
+	"Aadhaar Card",
+	"PAN Card",
+	"Driving License",
+	"Passport",
+	"Voter ID",
 }
 
 type RentalItem struct {
-	Description string
-	Rate        float64
-	Days        int
-	FromDate    time.Time
-	ToDate      time.Time
+	Description string    `json:"description"`
+	Rate        float64   `json:"rate"`
+	Days        int       `json:"days"`
+	FromDate    time.Time `json:"from_date"`
+	ToDate      time.Time `json:"to_date"`
+	RoomNumber  string    `json:"room_number,omitempty"`
 }
 
 type Bill struct {
-	BillNumber string
-	Customer   Customer
-	Adults     int
-	Children   int
-	Items      []RentalItem
-	Date       time.Time
+	BillNumber    string           `json:"bill_number"`
+	Customer      Customer         `json:"customer"`
+	BillTo        *Company         `json:"bill_to,omitempty"`
+	GuestGSTIN    string           `json:"guest_gstin,omitempty"`
+	PlaceOfSupply string           `json:"place_of_supply"`
+	Adults        int              `json:"adults"`
+	Children      int              `json:"children"`
+	Guests        []StayGuest      `json:"guests,omitempty"`
+	Items         []RentalItem     `json:"items"`
+	CheckInTime   string           `json:"check_in_time,omitempty"`
+	CheckOutTime  string           `json:"check_out_time,omitempty"`
+	Purpose       string           `json:"purpose,omitempty"`
+	ComingFrom    string           `json:"coming_from,omitempty"`
+	GoingTo       string           `json:"going_to,omitempty"`
+	Payments      []Payment        `json:"payments,omitempty"`
+	Date          time.Time        `json:"date"`
+	EInvoice      *EInvoiceDetails `json:"e_invoice,omitempty"`
+	CreatedBy     string           `json:"created_by,omitempty"`
+	Cancellation  *Cancellation    `json:"cancellation,omitempty"`
+	FormC         *FormCFiling     `json:"form_c,omitempty"`
 }
 
 // CustomerDB handles customer data storage
 type CustomerDB struct {
 	customers []Customer
 	filePath  string
+	index     *customerIndex
+	// loadErr keeps a failed load from being overwritten by the next save
+	loadErr error
 }
 
 func NewCustomerDB() *CustomerDB {
@@ -652,62 +681,328 @@ func NewCustomerDB() *CustomerDB {
 }
 
 func (db *CustomerDB) loadCustomers() error {
-	data, err := ioutil.ReadFile(db.filePath)
+	db.customers = nil
+	db.index = nil
+	db.loadErr = nil
+	data, err := readDataFile(db.filePath)
 	if os.IsNotExist(err) {
 		return nil
 	}
-	if err != nil {
-		return err
+	if err == nil {
+		err = json.Unmarshal(data, &db.customers)
 	}
-	return json.Unmarshal(data, &db.customers)
+	db.loadErr = err
+	return err
 }
 
 func (db *CustomerDB) saveCustomers() error {
+	if db.loadErr != nil {
+		return fmt.Errorf("customers could not be loaded, not saving: %v", db.loadErr)
+	}
 	data, err := json.MarshalIndent(db.customers, "", "  ")
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(db.filePath, data, 0644)
+	return writeDataFile(db.filePath, data, 0644)
 }
 
-func (db *CustomerDB) addCustomer(customer Customer) error {
-	db.customers = append(db.customers, customer)
-	return db.saveCustomers()
+// change runs fn under the data lock on the customers as saved on disk
+func (db *CustomerDB) change(fn func() error) error {
+	return withDataLock(func() error {
+		if err := db.loadCustomers(); err != nil {
+			return fmt.Errorf("customers could not be loaded: %v", err)
+		}
+		return fn()
+	})
+}
+
+// addCustomer saves a new customer and sets its ID, which is given out
+// under the data lock so that no other process can take the same one
+func (db *CustomerDB) addCustomer(customer *Customer) error {
+	if customer.CreatedBy == "" {
+		customer.CreatedBy = actingUser()
+	}
+	return db.change(func() error {
+		customer.ID = db.nextCustomerID()
+		db.customers = append(db.customers, *customer)
+		return logChangeLocked(auditCreate, auditCustomer, customer.ID, nil, *customer, db.saveCustomers)
+	})
 }
 
 func (db *CustomerDB) getCustomers() []Customer {
 	return db.customers
 }
 
+func (db *CustomerDB) nextCustomerID() string {
+	for n := len(db.customers) + 1; ; n++ {
+		id := fmt.Sprintf("CUST%d", n)
+		if _, exists := db.getCustomer(id); !exists {
+			return id
+		}
+	}
+}
+
+func (db *CustomerDB) getCustomer(id string) (Customer, bool) {
+	for _, c := range db.customers {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Customer{}, false
+}
+
+// updateCustomer replaces the saved customer with the same ID
+func (db *CustomerDB) updateCustomer(customer Customer) error {
+	return db.change(func() error {
+		for i, c := range db.customers {
+			if c.ID == customer.ID {
+				db.customers[i] = customer
+				return logChangeLocked(auditUpdate, auditCustomer, customer.ID, c, customer, db.saveCustomers)
+			}
+		}
+		return fmt.Errorf("customer %s not found", customer.ID)
+	})
+}
+
+// updateCustomerNotes changes only the notes of the saved customer, so that
+// changes made elsewhere since it was loaded are kept
+func (db *CustomerDB) updateCustomerNotes(id, notes string) error {
+	return db.change(func() error {
+		for i, c := range db.customers {
+			if c.ID == id {
+				updated := c
+				updated.Notes = notes
+				db.customers[i] = updated
+				return logChangeLocked(auditUpdate, auditCustomer, id, c, updated, db.saveCustomers)
+			}
+		}
+		return fmt.Errorf("customer %s not found", id)
+	})
+}
+
+// validateCustomer checks the fields required by the Add New Customer window
+// apart from the ID photo, which can only be uploaded there
+func validateCustomer(customer Customer) error {
+	if customer.Name == "" || customer.Address == "" || customer.Phone == "" ||
+		customer.GovIDType == "" || customer.GovIDNumber == "" {
+		return fmt.Errorf("name, address, phone, ID type and ID number are required")
+	}
+	if customer.Foreign != nil {
+		return validateForeignCustomer(customer)
+	}
+	if foreignNationality(customer.Nationality) {
+		return fmt.Errorf("please enter the Form C details of the foreign national")
+	}
+	if err := validateGovID(customer.GovIDType, customer.GovIDNumber); err != nil {
+		return fmt.Errorf("ID number: %v", err)
+	}
+	return nil
+}
+
 func main() {
+	// Any arguments select the headless command-line mode
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
 	myApp := app.New()
 	mainWindow := myApp.NewWindow("Daily Room Rental System")
-	db := NewCustomerDB()
+	userDB := NewUserDB()
+
+	var showMainMenu func()
+	showMainMenu = func() {
+		db := NewCustomerDB()
+		billDB := NewBillDB()
+		companyDB := NewCompanyDB()
 
-	showMainMenu := func() {
 		addCustomerBtn := widget.NewButton("Add New Customer", func() {
-			showAddCustomerWindow(myApp, db)
+			showAddCustomerWindow(myApp, db, billDB, companyDB)
+		})
+
+		customersBtn := widget.NewButton("Customers", func() {
+			showCustomerListWindow(myApp, db, billDB, companyDB)
+		})
+
+		addCompanyBtn := widget.NewButton("Add Company", func() {
+			showAddCompanyWindow(myApp, companyDB)
 		})
 
 		createBillBtn := widget.NewButton("Create Bill", func() {
-			showCreateBillWindow(myApp, db)
+			showCreateBillWindow(myApp, db, billDB, companyDB, nil)
+		})
+
+		batchImportBtn := widget.NewButton("Batch Import", func() {
+			showBatchImportWindow(myApp, db, billDB, companyDB)
+		})
+
+		nightAuditBtn := widget.NewButton("Night Audit", func() {
+			showNightAuditWindow(myApp, billDB)
+		})
+
+		registerBtn := widget.NewButton("Guest Register", func() {
+			showGuestRegisterWindow(myApp, billDB)
+		})
+
+		formCBtn := widget.NewButton("Form C (Foreign Guests)", func() {
+			showFormCWindow(myApp, billDB)
+		})
+
+		// Remind staff of foreign guests not yet reported to the FRRO
+		formCReminder := widget.NewLabel("")
+		formCReminder.Hide()
+		if n := len(pendingFormC(billDB.getBills())); n > 0 && can(permViewIDDocuments) {
+			formCReminder.SetText(fmt.Sprintf("%d foreign guest stay(s) awaiting Form C", n))
+			formCReminder.Show()
+		}
+
+		analyticsBtn := widget.NewButton("Occupancy Analytics", func() {
+			showAnalyticsWindow(myApp, billDB)
+		})
+
+		gstr1Btn := widget.NewButton("GSTR-1 Export", func() {
+			showGSTR1ExportWindow(myApp, billDB)
+		})
+
+		eInvoiceBtn := widget.NewButton("E-Invoice", func() {
+			showEInvoiceWindow(myApp, billDB)
+		})
+
+		roomRatesBtn := widget.NewButton("Room Rates", func() {
+			showRoomRatesWindow(myApp)
+		})
+
+		settingsBtn := widget.NewButton("Settings", func() {
+			showSettingsWindow(myApp)
+		})
+
+		retentionBtn := widget.NewButton("ID Photo Retention", func() {
+			showPhotoRetentionWindow(myApp, db, billDB)
+		})
+
+		auditLogBtn := widget.NewButton("Audit Log", func() {
+			showAuditLogWindow(myApp)
+		})
+
+		usersBtn := widget.NewButton("Staff Accounts", func() {
+			showUsersWindow(myApp, userDB)
 		})
 
+		logoutBtn := widget.NewButton("Log Out", func() {
+			for _, w := range myApp.Driver().AllWindows() {
+				if w != mainWindow {
+					w.Close()
+				}
+			}
+			currentUser = nil
+			showLoginScreen(mainWindow, userDB, showMainMenu)
+		})
+
+		// Only the actions allowed for the user's role are shown
+		allow := func(btn *widget.Button, p permission) *widget.Button {
+			if !can(p) {
+				btn.Hide()
+			}
+			return btn
+		}
+
 		content := container.NewVBox(
 			widget.NewLabel("Daily Room Rental System"),
-			addCustomerBtn,
-			createBillBtn,
+			widget.NewLabel("Logged in as "+currentUser.Name+" ("+roleLabels[currentUser.Role]+")"),
+			formCReminder,
+			allow(addCustomerBtn, permAddCustomers),
+			customersBtn,
+			allow(addCompanyBtn, permAddCustomers),
+			allow(createBillBtn, permCreateBills),
+			allow(batchImportBtn, permCreateBills),
+			allow(nightAuditBtn, permExportData),
+			allow(registerBtn, permExportData),
+			allow(formCBtn, permViewIDDocuments),
+			allow(analyticsBtn, permExportData),
+			allow(gstr1Btn, permExportData),
+			allow(eInvoiceBtn, permExportData),
+			allow(roomRatesBtn, permEditRates),
+			allow(settingsBtn, permManageSettings),
+			allow(retentionBtn, permManageSettings),
+			allow(usersBtn, permManageUsers),
+			allow(auditLogBtn, permViewAuditLog),
+			logoutBtn,
 		)
 
 		mainWindow.SetContent(container.NewPadded(content))
 	}
 
-	showMainMenu()
+	// Encrypted data is unlocked from the environment or at the unlock
+	// screen, then staff log in
+	login := func() {
+		showLoginScreen(mainWindow, userDB, showMainMenu)
+	}
+	if err := unlockFromEnv(); err != nil {
+		showUnlockScreen(mainWindow, login)
+	} else {
+		login()
+	}
 	mainWindow.Resize(fyne.NewSize(300, 200))
 	mainWindow.ShowAndRun()
 }
 
-func showAddCustomerWindow(myApp fyne.App, db *CustomerDB) {
+// uploadIDPhoto lets staff pick an ID photo, or take one from a capture
+// source if any is configured, and stores it processed in the photo
+// directory, encrypted if enabled, before calling onSaved with its path
+func uploadIDPhoto(window fyne.Window, onSaved func(path string)) {
+	pickIDImage(window, func(img capturedImage) {
+		storeIDImage(window, img, onSaved)
+	})
+}
+
+// addIDPhotoBack picks the back of an ID card and stores it below the front
+// as a new photo, replacing the one of the front only
+func addIDPhotoBack(window fyne.Window, frontPath string, onSaved func(path string)) {
+	pickIDImage(window, func(back capturedImage) {
+		front, err := readDataFile(frontPath)
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		if back.data, err = combineIDPhotos(front, back.data); err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		storeIDImage(window, back, func(path string) {
+			os.Remove(frontPath)
+			onSaved(path)
+		})
+	})
+}
+
+func chooseIDPhotoFile(window fyne.Window, onPicked func(img capturedImage)) {
+	fd := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		// The type is taken from the content, not the file name
+		data, err = processIDPhoto(data)
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		onPicked(capturedImage{data: data})
+	}, window)
+	fd.SetFilter(storage.NewExtensionFileFilter([]string{".png", ".jpg", ".jpeg"}))
+	fd.Show()
+}
+
+func showAddCustomerWindow(myApp fyne.App, db *CustomerDB, billDB *BillDB, companyDB *CompanyDB) {
 	window := myApp.NewWindow("Add New Customer")
 
 	customerNameEntry := widget.NewEntry()
@@ -719,58 +1014,82 @@ func showAddCustomerWindow(myApp fyne.App, db *CustomerDB) {
 	phoneEntry := widget.NewEntry()
 	phoneEntry.SetPlaceHolder("Phone Number")
 
+	nationalityEntry := widget.NewEntry()
+	nationalityEntry.SetPlaceHolder("Nationality")
+	nationalityEntry.SetText("Indian")
+
 	// Government ID Type dropdown
-	idTypeSelect := widget.NewSelect([]string{
-		"Aadhaar Card",
-		"PAN Card",
-		"Driving License",
-		"Passport",
-		"Voter ID",
-	}, nil)
+	idTypeSelect := widget.NewSelect(govIDTypes, nil)
 	idTypeSelect.PlaceHolder = "Select ID Type"
 
+	// Foreign nationals register with their passport and the Form C details
+	foreignForm := newForeignDetailsForm()
+	foreignForm.content.Hide()
+	var foreignCheck *widget.Check
+
 	idNumberEntry := widget.NewEntry()
 	idNumberEntry.SetPlaceHolder("Government ID Number")
+	idNumberEntry.Validator = func(text string) error {
+		if idTypeSelect.Selected == "" || text == "" {
+			return nil
+		}
+		if foreignCheck.Checked {
+			return validateForeignPassport(text)
+		}
+		return validateGovID(idTypeSelect.Selected, text)
+	}
+	idTypeSelect.OnChanged = func(idType string) {
+		idNumberEntry.SetPlaceHolder(govIDHints[idType])
+		idNumberEntry.Validate()
+	}
+
+	foreignCheck = widget.NewCheck("Foreign National", func(foreign bool) {
+		if foreign {
+			idTypeSelect.SetSelected("Passport")
+			idTypeSelect.Disable()
+			idNumberEntry.SetPlaceHolder("Passport Number")
+			nationalityEntry.SetText("")
+			foreignForm.content.Show()
+		} else {
+			idTypeSelect.Enable()
+			nationalityEntry.SetText("Indian")
+			foreignForm.reset()
+			foreignForm.content.Hide()
+		}
+		idNumberEntry.Validate()
+	})
+
+	// Optional company the guest is usually billed to
+	companies := companyDB.getCompanies()
+	companySelect := widget.NewSelect(companyOptions(companies), nil)
+	companySelect.PlaceHolder = "Billing Company (optional)"
 
 	var selectedPhotoPath string
 	photoLabel := widget.NewLabel("No photo selected")
+	photoPreview := idPhotoPreview()
+	photoPreview.Hide()
+
+	var addBackBtn *widget.Button
+	setPhoto := func(path string) {
+		selectedPhotoPath = path
+		photoLabel.SetText("Photo selected: " + filepath.Base(path))
+		showIDPhotoPreview(photoPreview, path)
+		photoPreview.Show()
+		addBackBtn.Enable()
+	}
 
 	selectPhotoBtn := widget.NewButton("Upload ID Photo", func() {
-		fd := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
-			if err != nil {
-				dialog.ShowError(err, window)
-				return
-			}
-			if reader == nil {
-				return
-			}
-			defer reader.Close()
-
-			// Create a unique filename for the photo
-			photoFileName := fmt.Sprintf("customer_data/id_photos/id_%d%s",
-				time.Now().UnixNano(),
-				filepath.Ext(reader.URI().String()))
-
-			// Copy the file to our storage location
-			newFile, err := os.Create(photoFileName)
-			if err != nil {
-				dialog.ShowError(err, window)
-				return
-			}
-			defer newFile.Close()
-
-			// Copy the content
-			if _, err := io.Copy(newFile, reader); err != nil {
-				dialog.ShowError(err, window)
-				return
-			}
+		uploadIDPhoto(window, setPhoto)
+	})
 
-			selectedPhotoPath = photoFileName
-			photoLabel.SetText("Photo selected: " + filepath.Base(photoFileName))
-		}, window)
-		fd.SetFilter(storage.NewExtensionFileFilter([]string{".png", ".jpg", ".jpeg"}))
-		fd.Show()
+	// The back of the card is added below the front in the same photo
+	addBackBtn = widget.NewButton("Add Back Side", func() {
+		addIDPhotoBack(window, selectedPhotoPath, func(path string) {
+			setPhoto(path)
+			addBackBtn.Disable()
+		})
 	})
+	addBackBtn.Disable()
 
 	statusLabel := widget.NewLabel("")
 
@@ -782,34 +1101,78 @@ func showAddCustomerWindow(myApp fyne.App, db *CustomerDB) {
 			statusLabel.SetText("Please fill in all fields and upload ID photo")
 			return
 		}
+		var foreign *ForeignDetails
+		if foreignCheck.Checked {
+			var err error
+			if foreign, err = foreignForm.details(); err != nil {
+				statusLabel.SetText(err.Error())
+				return
+			}
+		} else if foreignNationality(nationalityEntry.Text) {
+			statusLabel.SetText("Please tick Foreign National and enter the Form C details")
+			return
+		} else if err := validateGovID(idTypeSelect.Selected, idNumberEntry.Text); err != nil {
+			statusLabel.SetText("Invalid ID number: " + err.Error())
+			return
+		}
+
+		var companyID string
+		if i := companySelect.SelectedIndex(); i > 0 {
+			companyID = companies[i-1].ID
+		}
 
 		customer := Customer{
-			ID:             fmt.Sprintf("CUST%d", len(db.getCustomers())+1),
 			Name:           customerNameEntry.Text,
 			Address:        addressEntry.Text,
 			Phone:          phoneEntry.Text,
 			GovIDType:      idTypeSelect.Selected,
-			GovIDNumber:    idNumberEntry.Text,
+			GovIDNumber:    normalizeGovID(idNumberEntry.Text),
 			GovIDPhotoPath: selectedPhotoPath,
+			CompanyID:      companyID,
+			Nationality:    strings.TrimSpace(nationalityEntry.Text),
+			Foreign:        foreign,
 			AddedOn:        time.Now(),
 		}
-
-		err := db.addCustomer(customer)
-		if err != nil {
-			statusLabel.SetText("Error saving customer: " + err.Error())
-			return
+		if foreign != nil {
+			if err := validateForeignCustomer(customer); err != nil {
+				statusLabel.SetText(err.Error())
+				return
+			}
 		}
 
-		statusLabel.SetText("Customer saved successfully!")
+		save := func() {
+			err := db.addCustomer(&customer)
+			if err != nil {
+				statusLabel.SetText("Error saving customer: " + err.Error())
+				return
+			}
+
+			statusLabel.SetText("Customer " + customer.ID + " saved successfully!")
+
+			// Clear fields after successful save
+			customerNameEntry.SetText("")
+			addressEntry.SetText("")
+			phoneEntry.SetText("")
+			foreignCheck.SetChecked(false)
+			nationalityEntry.SetText("Indian")
+			idTypeSelect.Selected = ""
+			idNumberEntry.SetText("")
+			companySelect.ClearSelected()
+			selectedPhotoPath = ""
+			photoLabel.SetText("No photo selected")
+			photoPreview.Hide()
+			addBackBtn.Disable()
+		}
 
-		// Clear fields after successful save
-		customerNameEntry.SetText("")
-		addressEntry.SetText("")
-		phoneEntry.SetText("")
-		idTypeSelect.Selected = ""
-		idNumberEntry.SetText("")
-		selectedPhotoPath = ""
-		photoLabel.SetText("No photo selected")
+		matches := db.findDuplicates(customer)
+		if len(matches) == 0 {
+			save()
+			return
+		}
+		showDuplicatesDialog(window, matches, func(existing Customer) {
+			showCustomerProfileWindow(myApp, db, billDB, companyDB, existing.ID)
+			window.Close()
+		}, save)
 	})
 
 	content := container.NewVBox(
@@ -817,20 +1180,27 @@ func showAddCustomerWindow(myApp fyne.App, db *CustomerDB) {
 		customerNameEntry,
 		addressEntry,
 		phoneEntry,
+		foreignCheck,
+		nationalityEntry,
 		idTypeSelect,
 		idNumberEntry,
-		selectPhotoBtn,
+		foreignForm.content,
+		companySelect,
+		container.NewGridWithColumns(2, selectPhotoBtn, addBackBtn),
 		photoLabel,
+		photoPreview,
 		saveButton,
 		statusLabel,
 	)
 
-	window.SetContent(container.NewPadded(content))
-	window.Resize(fyne.NewSize(400, 500))
+	window.SetContent(container.NewPadded(container.NewVScroll(content)))
+	window.Resize(fyne.NewSize(420, 600))
 	window.Show()
 }
 
-func showCreateBillWindow(myApp fyne.App, db *CustomerDB) {
+// showCreateBillWindow opens the bill form. When previous is set the form is
+// pre-filled with that bill's guest, company and rooms for a stay starting today.
+func showCreateBillWindow(myApp fyne.App, db *CustomerDB, billDB *BillDB, companyDB *CompanyDB, previous *Bill) {
 	window := myApp.NewWindow("Create Bill")
 
 	// Customer selection
@@ -840,17 +1210,18 @@ func showCreateBillWindow(myApp fyne.App, db *CustomerDB) {
 		return
 	}
 
-	var selectedCustomer *Customer
-	customerOptions := make([]string, len(customers))
-	for i, c := range customers {
-		customerOptions[i] = fmt.Sprintf("%s - %s (%s)", c.ID, c.Name, c.Phone)
-	}
+	// Billing entity for B2B invoices
+	companies := companyDB.getCompanies()
+	companySelect := widget.NewSelect(companyOptions(companies), nil)
+	companySelect.SetSelectedIndex(0)
 
-	customerSelect := widget.NewSelect(customerOptions, func(selected string) {
-		for _, c := range customers {
-			if fmt.Sprintf("%s - %s (%s)", c.ID, c.Name, c.Phone) == selected {
-				selectedCustomer = &c
-				break
+	var selectedCustomer *Customer
+	customerPicker := newCustomerPicker(db, func(c Customer) {
+		selectedCustomer = &c
+		companySelect.SetSelectedIndex(0)
+		for i, company := range companies {
+			if company.ID == c.CompanyID {
+				companySelect.SetSelectedIndex(i + 1)
 			}
 		}
 	})
@@ -883,15 +1254,63 @@ func showCreateBillWindow(myApp fyne.App, db *CustomerDB) {
 	adultsEntry.Validator = validateNumber
 	childrenEntry.Validator = validateNumber
 
-	// Room Details
-	roomTypeSelect := widget.NewSelect([]string{
-		"NON-AC Room",
-		"AC Room",
-	}, nil)
+	// Stay details for the guest register
+	checkInEntry := widget.NewEntry()
+	checkInEntry.SetPlaceHolder("Check-in Time (HH:MM)")
+	checkInEntry.SetText(defaultCheckInTime)
+
+	checkOutEntry := widget.NewEntry()
+	checkOutEntry.SetPlaceHolder("Check-out Time (HH:MM)")
+	checkOutEntry.SetText(defaultCheckOutTime)
+
+	purposeEntry := widget.NewSelectEntry(visitPurposes)
+	purposeEntry.SetPlaceHolder("Purpose of Visit")
+
+	comingFromEntry := widget.NewEntry()
+	comingFromEntry.SetPlaceHolder("Coming From")
+
+	goingToEntry := widget.NewEntry()
+	goingToEntry.SetPlaceHolder("Going To")
+
+	// Other occupants, whose counts are filled in from the list
+	guestEditor := newGuestListEditor(window, func(guests []StayGuest) {
+		if len(guests) == 0 {
+			return
+		}
+		adults, children := guestCounts(guests)
+		adultsEntry.SetText(strconv.Itoa(adults))
+		childrenEntry.SetText(strconv.Itoa(children))
+	})
+
+	// Advance received at check-in
+	advanceEntry := widget.NewEntry()
+	advanceEntry.SetPlaceHolder("Advance Paid (optional)")
 
+	paymentModeSelect := widget.NewSelect(paymentModes, nil)
+	paymentModeSelect.SetSelected(paymentModes[0])
+
+	// Room Details
+	settings := loadSettings()
 	rateEntry := widget.NewEntry()
 	rateEntry.SetPlaceHolder("Rate per Day")
 
+	roomNumberEntry := widget.NewEntry()
+	roomNumberEntry.SetPlaceHolder("Room Number (optional)")
+
+	// The standard rate is filled in, and is fixed for staff who may not
+	// edit rates
+	roomTypeSelect := widget.NewSelect(roomTypes, func(roomType string) {
+		rate, ok := settings.RoomRates[roomType]
+		if !ok {
+			rateEntry.Enable()
+			return
+		}
+		rateEntry.SetText(strconv.FormatFloat(rate, 'f', 2, 64))
+		if !can(permEditRates) {
+			rateEntry.Disable()
+		}
+	})
+
 	fromDate := time.Now()
 	toDate := time.Now()
 
@@ -939,7 +1358,7 @@ func showCreateBillWindow(myApp fyne.App, db *CustomerDB) {
 			return
 		}
 
-		days := int(toDate.Sub(fromDate).Hours()/24) + 1
+		days := stayDays(fromDate, toDate)
 		if days < 1 {
 			statusLabel.SetText("To Date must be after From Date")
 			return
@@ -956,6 +1375,11 @@ func showCreateBillWindow(myApp fyne.App, db *CustomerDB) {
 			Days:        days,
 			FromDate:    fromDate,
 			ToDate:      toDate,
+			RoomNumber:  strings.TrimSpace(roomNumberEntry.Text),
+		}
+		if err := settings.checkRoomRate(item); err != nil {
+			statusLabel.SetText(err.Error())
+			return
 		}
 
 		rentalItems = append(rentalItems, item)
@@ -963,6 +1387,7 @@ func showCreateBillWindow(myApp fyne.App, db *CustomerDB) {
 		statusLabel.SetText("Room added successfully!")
 	})
 
+	regCardCheck := widget.NewCheck("Also print registration card", nil)
 	generateButton := widget.NewButton("Generate Bill", func() {
 		if selectedCustomer == nil {
 			statusLabel.SetText("Please select a customer")
@@ -996,35 +1421,145 @@ func showCreateBillWindow(myApp fyne.App, db *CustomerDB) {
 			return
 		}
 
+		var billTo *Company
+		var guestGSTIN string
+		if i := companySelect.SelectedIndex(); i > 0 {
+			company := companies[i-1]
+			if err := validateGSTIN(company.GSTIN); err != nil {
+				statusLabel.SetText("Billing company has an " + err.Error())
+				return
+			}
+			billTo = &company
+			guestGSTIN = company.GSTIN
+		}
+
+		var payments []Payment
+		if advanceEntry.Text != "" {
+			advance, err := strconv.ParseFloat(advanceEntry.Text, 64)
+			if err != nil || advance < 0 {
+				statusLabel.SetText("Please enter a valid advance amount")
+				return
+			}
+			if advance > 0 {
+				payments = append(payments, Payment{
+					Mode:   paymentModeSelect.Selected,
+					Amount: advance,
+					Date:   time.Now(),
+				})
+			}
+		}
+
 		bill := Bill{
-			BillNumber: billNumberEntry.Text,
-			Customer:   *selectedCustomer,
-			Adults:     adults,
-			Children:   children,
-			Items:      rentalItems,
-			Date:       time.Now(),
+			BillNumber:    billNumberEntry.Text,
+			Customer:      *selectedCustomer,
+			BillTo:        billTo,
+			GuestGSTIN:    guestGSTIN,
+			PlaceOfSupply: sellerStateCode,
+			Adults:        adults,
+			Children:      children,
+			Guests:        guestEditor.guests,
+			Items:         rentalItems,
+			CheckInTime:   strings.TrimSpace(checkInEntry.Text),
+			CheckOutTime:  strings.TrimSpace(checkOutEntry.Text),
+			Purpose:       strings.TrimSpace(purposeEntry.Text),
+			ComingFrom:    strings.TrimSpace(comingFromEntry.Text),
+			GoingTo:       strings.TrimSpace(goingToEntry.Text),
+			Payments:      payments,
+			Date:          time.Now(),
 		}
 
-		err := generatePDF(bill)
-		if err != nil {
-			statusLabel.SetText("Error generating PDF: " + err.Error())
+		if err := validateBill(bill); err != nil {
+			statusLabel.SetText("Invalid bill: " + err.Error())
+			return
+		}
+		for _, item := range bill.Items {
+			if err := settings.checkRoomRate(item); err != nil {
+				statusLabel.SetText(err.Error())
+				return
+			}
+		}
+
+		if err := billDB.addBill(&bill); err != nil {
+			statusLabel.SetText("Error saving bill: " + err.Error())
+			return
+		}
+		if err := generatePDF(bill); err != nil {
+			statusLabel.SetText("Bill saved but PDF could not be generated: " + err.Error())
 			return
 		}
 
-		statusLabel.SetText("Bill generated successfully!")
+		if !regCardCheck.Checked {
+			statusLabel.SetText("Bill generated successfully!")
+			return
+		}
+		path, err := generateRegistrationCard(bill)
+		if err != nil {
+			statusLabel.SetText("Bill generated, but the registration card failed: " + err.Error())
+			return
+		}
+		statusLabel.SetText("Bill generated successfully! Registration card saved to " + path)
 	})
 
+	if previous != nil {
+		customerPicker.selectID(previous.Customer.ID)
+		companySelect.SetSelectedIndex(0)
+		if previous.BillTo != nil {
+			for i, company := range companies {
+				if company.ID == previous.BillTo.ID {
+					companySelect.SetSelectedIndex(i + 1)
+				}
+			}
+		}
+		adultsEntry.SetText(strconv.Itoa(previous.Adults))
+		childrenEntry.SetText(strconv.Itoa(previous.Children))
+		guestEditor.setGuests(append([]StayGuest{}, previous.Guests...))
+		purposeEntry.SetText(previous.Purpose)
+		comingFromEntry.SetText(previous.ComingFrom)
+		goingToEntry.SetText(previous.GoingTo)
+		billNumberEntry.SetText(billDB.nextBillNumber())
+
+		today := time.Now()
+		for _, item := range previous.Items {
+			rate := item.Rate
+			if standard, ok := settings.RoomRates[item.Description]; ok && !can(permEditRates) {
+				rate = standard
+			}
+			rentalItems = append(rentalItems, RentalItem{
+				Description: item.Description,
+				Rate:        rate,
+				Days:        item.Days,
+				FromDate:    today,
+				ToDate:      today.AddDate(0, 0, item.Days-1),
+				RoomNumber:  item.RoomNumber,
+			})
+		}
+		updateItemsList()
+	}
+
 	content := container.NewVBox(
 		widget.NewLabel("Select Customer:"),
-		customerSelect,
+		customerPicker.content,
 		widget.NewLabel("Bill Details:"),
 		billNumberEntry,
+		widget.NewLabel("Bill To Company:"),
+		companySelect,
+		widget.NewLabel("Place of Supply: "+stateLabel(sellerStateCode)),
 		widget.NewLabel("Number of Guests:"),
 		adultsEntry,
 		childrenEntry,
+		widget.NewLabel("Other Guests (ID required for every adult):"),
+		guestEditor.content,
+		widget.NewLabel("Stay Details:"),
+		container.NewGridWithColumns(2, checkInEntry, checkOutEntry),
+		purposeEntry,
+		container.NewGridWithColumns(2, comingFromEntry, goingToEntry),
+		widget.NewLabel("Advance Payment:"),
+		advanceEntry,
+		paymentModeSelect,
 		widget.NewLabel("Room Details:"),
 		roomTypeSelect,
 		rateEntry,
+		roomNumberEntry,
 		fromDateButton,
 		fromDatePicker,
 		toDateButton,
@@ -1032,11 +1567,12 @@ func showCreateBillWindow(myApp fyne.App, db *CustomerDB) {
 		addButton,
 		widget.NewLabel("\nBooked Rooms:"),
 		itemsList,
+		regCardCheck,
 		generateButton,
 		statusLabel,
 	)
 
-	window.SetContent(container.NewPadded(content))
+	window.SetContent(container.NewPadded(container.NewVScroll(content)))
 	window.Resize(fyne.NewSize(500, 800))
 	window.Show()
 }
@@ -1095,212 +1631,24 @@ func generatePDF(bill Bill) error {
 		return fmt.Errorf("failed to create Invoice directory: %v", err)
 	}
 
-	// Create filename with bill number
-	filename := filepath.Join("Invoice", fmt.Sprintf("Invoice_%s.pdf", bill.BillNumber))
-
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.AddPage()
-
-	// Company Header
-	pdf.SetFont("Arial", "B", 20)
-	pdf.Cell(190, 10, "Trinity Stays")
-	pdf.Ln(8)
-
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(190, 5, "123, Main Street, Chennai - 600001")
-	pdf.Ln(5)
-	pdf.Cell(190, 5, "Phone: +91 98765 43210")
-	pdf.Ln(5)
-	pdf.Cell(190, 5, "GSTIN: 33AALCT2345K1ZB")
-	pdf.Ln(15)
-
-	// Add line separator
-	pdf.Line(10, pdf.GetY(), 200, pdf.GetY())
-	pdf.Ln(5)
-
-	// Bill Details in a box
-	pdf.SetFillColor(240, 240, 240)
-	pdf.SetFont("Arial", "B", 12)
-
-	// Create a box for Bill Details
-	startY := pdf.GetY()
-	pdf.Rect(10, startY, 90, 8, "F")
-	pdf.Cell(90, 8, "Bill Details")
-
-	// Create a box for Customer Details
-	pdf.Rect(105, startY, 90, 8, "F")
-	pdf.Cell(5, 8, "") // spacing
-	pdf.Cell(90, 8, "Customer Details")
-	pdf.Ln(10)
-
-	pdf.SetFont("Arial", "", 10)
-	// Left side - Bill details with borders
-	startY = pdf.GetY()
-	pdf.Rect(10, startY, 90, 24, "D") // Border for bill details
-	pdf.SetX(15)                      // Indent from left
-	pdf.Cell(25, 6, "Bill No:")
-	pdf.SetFont("Arial", "B", 10)
-	pdf.Cell(60, 6, bill.BillNumber)
-	pdf.Ln(6)
-	pdf.SetX(15)
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(25, 6, "Date:")
-	pdf.SetFont("Arial", "B", 10)
-	pdf.Cell(60, 6, bill.Date.Format("02-01-2006"))
-	pdf.Ln(6)
-	pdf.SetX(15)
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(25, 6, "GSTIN:")
-	pdf.SetFont("Arial", "B", 10)
-	pdf.Cell(60, 6, "33AALCT2345K1ZB")
-	pdf.Ln(6)
-
-	// Right side - Customer details with borders
-	pdf.Rect(105, startY, 90, 40, "D") // Border for customer details
-	pdf.SetXY(110, startY)             // Indent from left of customer section
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(25, 6, "Name:")
-	pdf.SetFont("Arial", "B", 10)
-	pdf.Cell(60, 6, bill.Customer.Name)
-	pdf.Ln(6)
-	pdf.SetX(110)
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(25, 6, "Phone:")
-	pdf.SetFont("Arial", "B", 10)
-	pdf.Cell(60, 6, bill.Customer.Phone)
-	pdf.Ln(6)
-	pdf.SetX(110)
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(25, 6, "ID Type:")
-	pdf.SetFont("Arial", "B", 10)
-	pdf.Cell(60, 6, bill.Customer.GovIDType)
-	pdf.Ln(6)
-	pdf.SetX(110)
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(25, 6, "ID No:")
-	pdf.SetFont("Arial", "B", 10)
-	pdf.Cell(60, 6, bill.Customer.GovIDNumber)
-	pdf.Ln(6)
-
-	// Move to the maximum Y position used
-	pdf.SetY(math.Max(pdf.GetY(), startY+45))
-	pdf.Ln(5)
-
-	// Guest Information with a light background
-	pdf.SetFillColor(240, 240, 240)
-	pdf.Rect(10, pdf.GetY(), 185, 8, "F")
-	pdf.SetX(15)
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(50, 8, "No. of Guests:")
-	pdf.SetFont("Arial", "B", 10)
-	pdf.Cell(130, 8, fmt.Sprintf("%d Adults, %d Children", bill.Adults, bill.Children))
-	pdf.Ln(12)
-
-	// Address with a light background
-	pdf.SetFillColor(240, 240, 240)
-	pdf.Rect(10, pdf.GetY(), 185, 8, "F")
-	pdf.SetX(15)
-	pdf.SetFont("Arial", "", 10)
-	pdf.Cell(50, 8, "Address:")
-	pdf.SetFont("Arial", "B", 10)
-	// Handle multi-line address
-	addressY := pdf.GetY() + 8
-	pdf.SetXY(65, addressY-8)
-	pdf.MultiCell(130, 8, bill.Customer.Address, "", "", false)
-	pdf.Ln(4)
-
-	// Add line separator
-	pdf.Line(10, pdf.GetY(), 200, pdf.GetY())
-	pdf.Ln(5)
-
-	// Table headers with filled background
-	pdf.SetFillColor(240, 240, 240)
-	pdf.SetFont("Arial", "B", 10)
-
-	// Create table header cells with border
-	pdf.CellFormat(45, 8, "Room Type", "1", 0, "", true, 0, "")
-	pdf.CellFormat(30, 8, "Rate/Day", "1", 0, "", true, 0, "")
-	pdf.CellFormat(20, 8, "Days", "1", 0, "", true, 0, "")
-	pdf.CellFormat(55, 8, "Period", "1", 0, "", true, 0, "")
-	pdf.CellFormat(40, 8, "Amount", "1", 1, "", true, 0, "")
-
-	// Items
-	pdf.SetFont("Arial", "", 10)
-	subtotal := 0.0
-	for _, item := range bill.Items {
-		amount := item.Rate * float64(item.Days)
-		subtotal += amount
-
-		period := fmt.Sprintf("%s to %s",
-			item.FromDate.Format("02/01/06"), item.ToDate.Format("02/01/06"))
-
-		pdf.CellFormat(45, 8, item.Description, "1", 0, "", false, 0, "")
-		pdf.CellFormat(30, 8, fmt.Sprintf("₹%.2f", item.Rate), "1", 0, "", false, 0, "")
-		pdf.CellFormat(20, 8, fmt.Sprintf("%d", item.Days), "1", 0, "", false, 0, "")
-		pdf.CellFormat(55, 8, period, "1", 0, "", false, 0, "")
-		pdf.CellFormat(40, 8, fmt.Sprintf("₹%.2f", amount), "1", 1, "", false, 0, "")
-	}
+	filename := invoicePath(bill.BillNumber)
 
-	// Totals section with right alignment
-	pdf.Ln(5)
-	gst := subtotal * 0.18
-	total := subtotal + gst
-
-	// Add line separator
-	pdf.Line(10, pdf.GetY(), 200, pdf.GetY())
-	pdf.Ln(5)
-
-	pdf.SetFont("Arial", "B", 10)
-	// Right-aligned totals using CellFormat
-	pdf.CellFormat(150, 8, "Subtotal:", "", 0, "R", false, 0, "")
-	pdf.CellFormat(40, 8, fmt.Sprintf("₹%.2f", subtotal), "", 1, "R", false, 0, "")
-
-	pdf.CellFormat(150, 8, "GST (18%):", "", 0, "R", false, 0, "")
-	pdf.CellFormat(40, 8, fmt.Sprintf("₹%.2f", gst), "", 1, "R", false, 0, "")
-
-	// Total amount with box
-	pdf.SetFillColor(240, 240, 240)
-	pdf.CellFormat(150, 8, "Total Amount:", "1", 0, "R", true, 0, "")
-	pdf.CellFormat(40, 8, fmt.Sprintf("₹%.2f", total), "1", 1, "R", true, 0, "")
-	pdf.Ln(15)
-
-	// Terms and conditions
-	pdf.SetFont("Arial", "B", 10)
-	pdf.Cell(190, 6, "Terms & Conditions:")
-	pdf.Ln(6)
-	pdf.SetFont("Arial", "", 8)
-	terms := []string{
-		"1. Check-in time is 12:00 PM and check-out time is 11:00 AM",
-		"2. Payment to be made in advance",
-		"3. No refunds for early check-out",
-		"4. ID proof is mandatory for all guests",
-		"5. Outside food is not allowed",
-		"6. Pets are not allowed",
-		"7. The management is not responsible for any valuables",
-		"8. Any damage to hotel property will be charged",
-	}
-	for _, term := range terms {
-		pdf.Cell(190, 4, term)
-		pdf.Ln(4)
+	// Lay out the invoice with the template selected in settings
+	settings := loadSettings()
+	var renderer invoiceRenderer = newTemplateRenderer(findTemplate(settings.InvoiceTemplate), settings)
+	pdf, err := renderer.Render(bill)
+	if err != nil {
+		return err
 	}
 
-	// Footer with signature
-	pdf.Ln(10)
-	pdf.Line(140, pdf.GetY(), 190, pdf.GetY())
-	pdf.Ln(3)
-	pdf.SetFont("Arial", "", 8)
-	pdf.Cell(130, 4, "")
-	pdf.Cell(60, 4, "Authorized Signature")
-
-	// Add page numbers
-	pdf.SetFont("Arial", "I", 8)
-	pdf.SetY(280)
-	pdf.SetX(10)
-	pdf.Cell(0, 10, fmt.Sprintf("Page %d", pdf.PageNo()))
-
 	return pdf.OutputFileAndClose(filename)
 }
 
+// invoicePath returns the PDF file name for a bill number
+func invoicePath(billNumber string) string {
+	return filepath.Join("Invoice", fmt.Sprintf("Invoice_%s.pdf", billNumber))
+}
+
 func generateYears() []string {
 	currentYear := time.Now().Year()
 	years := make([]string, 5)
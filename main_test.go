@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testAdmin is the user tests run as
+var testAdmin = User{Username: "admin", Name: "Test Admin", Role: roleAdmin}
+
+// inTempDir runs a test in an empty data directory as testAdmin
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(auditKeyFileEnv, filepath.Join(dir, "audit.key"))
+	user := currentUser
+	currentUser = &testAdmin
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		currentUser = user
+	})
+}
+
+func TestUpdateCustomerNotesKeepsOtherChanges(t *testing.T) {
+	inTempDir(t)
+	db := NewCustomerDB()
+	customer := Customer{Name: "Ravi Kumar", Phone: "9876543210", GovIDPhotoPath: "customer_data/id_photos/id_1.jpg"}
+	if err := db.addCustomer(&customer); err != nil {
+		t.Fatal(err)
+	}
+
+	// A purge clears the photo while the profile window is open
+	purged := customer
+	purged.GovIDPhotoPath = ""
+	if err := NewCustomerDB().updateCustomer(purged); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.updateCustomerNotes(customer.ID, "prefers ground floor"); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := NewCustomerDB().getCustomer(customer.ID)
+	if stored.Notes != "prefers ground floor" || stored.GovIDPhotoPath != "" {
+		t.Errorf("stored customer = %+v", stored)
+	}
+}
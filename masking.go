@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+)
+
+// UIDAI allows at most the last four Aadhaar digits to be displayed
+const maxAadhaarVisible = 4
+
+// idMaskRule decides how much of an ID number is shown on invoices, in the
+// customer screens and in exports
+type idMaskRule struct {
+	Mask    bool `json:"mask"`
+	Visible int  `json:"visible"`
+}
+
+var defaultIDMaskRule = idMaskRule{Mask: true, Visible: 4}
+
+// idMaskOptions are the choices offered in Settings for each ID type
+var idMaskOptions = []struct {
+	label string
+	rule  idMaskRule
+}{
+	{"Last 4 characters", idMaskRule{Mask: true, Visible: 4}},
+	{"Last 2 characters", idMaskRule{Mask: true, Visible: 2}},
+	{"Fully hidden", idMaskRule{Mask: true, Visible: 0}},
+	{"Full number", idMaskRule{Mask: false}},
+}
+
+func idMaskLabels(idType string) []string {
+	var labels []string
+	for _, o := range idMaskOptions {
+		if idType == "Aadhaar Card" && !o.rule.Mask {
+			continue
+		}
+		labels = append(labels, o.label)
+	}
+	return labels
+}
+
+func idMaskLabel(rule idMaskRule) string {
+	for _, o := range idMaskOptions {
+		if o.rule == rule {
+			return o.label
+		}
+	}
+	return idMaskOptions[0].label
+}
+
+func idMaskRuleFromLabel(label string) idMaskRule {
+	for _, o := range idMaskOptions {
+		if o.label == label {
+			return o.rule
+		}
+	}
+	return defaultIDMaskRule
+}
+
+// idMaskRule returns the configured rule for an ID type. Aadhaar numbers are
+// always masked to at most the last four digits.
+func (s Settings) idMaskRule(idType string) idMaskRule {
+	rule, ok := s.IDMaskRules[idType]
+	if !ok {
+		rule = defaultIDMaskRule
+	}
+	if idType == "Aadhaar Card" {
+		if !rule.Mask {
+			rule = defaultIDMaskRule
+		}
+		if rule.Visible > maxAadhaarVisible {
+			rule.Visible = maxAadhaarVisible
+		}
+	}
+	return rule
+}
+
+// maskGovID hides an ID number according to the rules in Settings, e.g.
+// XXXX-XXXX-1234 for Aadhaar or XXXXXX234F for PAN
+func (s Settings) maskGovID(idType, number string) string {
+	rule := s.idMaskRule(idType)
+	if !rule.Mask {
+		return number
+	}
+
+	n := normalizeGovID(number)
+	visible := rule.Visible
+	if visible > len(n) {
+		visible = len(n)
+	}
+	masked := strings.Repeat("X", len(n)-visible) + n[len(n)-visible:]
+
+	if idType == "Aadhaar Card" && len(masked) == 12 {
+		return masked[0:4] + "-" + masked[4:8] + "-" + masked[8:12]
+	}
+	return masked
+}
+
+// maskCustomer returns a copy of the customer with the ID number masked
+func (s Settings) maskCustomer(c Customer) Customer {
+	c.GovIDNumber = s.maskGovID(c.GovIDType, c.GovIDNumber)
+	return c
+}
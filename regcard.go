@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const regCardDir = "RegistrationCards"
+
+// ID photos are embedded at most this many pixels on either side
+const idPhotoThumbSide = 600
+
+// regCardPath returns the registration card file name for a bill number
+func regCardPath(billNumber string) string {
+	return filepath.Join(regCardDir, fmt.Sprintf("RegCard_%s.pdf", billNumber))
+}
+
+// registrationCardTemplate lays out the card with the page, fonts, colors
+// and logo of an invoice template
+func registrationCardTemplate(base InvoiceTemplate) InvoiceTemplate {
+	tmpl := base
+	tmpl.Title = base.label("reg_card")
+	tmpl.Sections = []string{"header", "separator", "reg_card", "page_number"}
+	return tmpl
+}
+
+// generateRegistrationCard writes the card for the guest to sign at
+// check-in and returns its path. Cards are only for printing and are
+// removed by the ID photo purge a day later, see buildPurgePlan.
+func generateRegistrationCard(bill Bill) (string, error) {
+	if err := os.MkdirAll(regCardDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s directory: %v", regCardDir, err)
+	}
+
+	settings := loadSettings()
+	tmpl := registrationCardTemplate(findTemplate(settings.InvoiceTemplate))
+	var renderer invoiceRenderer = newTemplateRenderer(tmpl, settings)
+	pdf, err := renderer.Render(bill)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return "", err
+	}
+	path := regCardPath(bill.BillNumber)
+	return path, writeFileAtomic(path, buf.Bytes(), 0600)
+}
+
+// drawRegistration prints the guest and stay details beside the ID photo,
+// the other occupants and the boxes for signatures
+func (r *templateRenderer) drawRegistration() {
+	pdf := r.pdf
+	tmpl := r.tmpl
+	bill := r.bill
+	c := bill.Customer
+
+	startY := pdf.GetY()
+	r.idPhoto(r.x(145), startY, r.w(50), r.w(32))
+	pdf.SetXY(r.x(145), startY+r.w(32))
+	r.font("", 8)
+	pdf.CellFormat(r.w(50), r.h(5), tmpl.label("id_photo"), "", 0, "C", false, 0, "")
+
+	pdf.SetY(startY)
+	r.field(10, 30, 100, 6, "Bill No:", bill.BillNumber)
+	r.field(10, 30, 100, 6, "Name:", c.Name)
+	r.field(10, 30, 100, 6, "Phone:", c.Phone)
+	r.field(10, 30, 100, 6, "Nationality:", c.nationality())
+	r.field(10, 30, 100, 6, c.GovIDType+":", r.settings.maskGovID(c.GovIDType, c.GovIDNumber))
+	if f := c.Foreign; f != nil {
+		r.field(10, 30, 100, 6, "Visa:", fmt.Sprintf("%s %s, valid till %s", f.VisaType, f.VisaNumber, f.VisaExpiry.Format("02-01-2006")))
+		r.field(10, 30, 100, 6, "In India since:", f.ArrivedInIndia.Format("02-01-2006"))
+	}
+	pdf.SetX(r.x(10))
+	r.font("", 10)
+	pdf.Cell(r.w(30), r.h(6), tmpl.label("address"))
+	r.font("B", 10)
+	pdf.MultiCell(r.w(100), r.h(6), c.Address, "", "", false)
+	if bill.BillTo != nil {
+		r.field(10, 30, 100, 6, "Company:", bill.BillTo.LegalName)
+	}
+	pdf.Ln(r.h(2))
+
+	r.field(10, 30, 150, 6, "Arrival:", bill.arrival().Format("02-01-2006 15:04"))
+	r.field(10, 30, 150, 6, "Departure:", bill.departure().Format("02-01-2006 15:04"))
+	r.field(10, 30, 150, 6, "Rooms:", stayRooms(bill))
+	r.field(10, 30, 150, 6, tmpl.label("guests"), fmt.Sprintf("%d Adults, %d Children", bill.Adults, bill.Children))
+	r.field(10, 30, 150, 6, "Purpose:", bill.Purpose)
+	r.field(10, 30, 150, 6, "Coming From:", bill.ComingFrom)
+	r.field(10, 30, 150, 6, "Going To:", bill.GoingTo)
+	pdf.Ln(r.h(4))
+
+	if len(bill.Guests) > 0 {
+		r.font("B", 10)
+		pdf.Cell(r.w(190), r.h(6), tmpl.label("stay_guests"))
+		pdf.Ln(r.h(7))
+		r.guestTable()
+		pdf.Ln(r.h(4))
+	}
+
+	r.font("", 9)
+	pdf.MultiCell(r.w(185), r.h(5), tmpl.label("declaration"), "", "", false)
+	pdf.Ln(r.h(4))
+
+	// Keep both signature boxes on one page
+	_, pageH := pdf.GetPageSize()
+	boxH := r.h(25)
+	if pdf.GetY()+boxH+r.h(6) > pageH-20 {
+		pdf.AddPage()
+	}
+	y := pdf.GetY()
+	pdf.Rect(r.x(10), y, r.w(85), boxH, "D")
+	pdf.Rect(r.x(110), y, r.w(85), boxH, "D")
+	r.font("", 8)
+	pdf.SetXY(r.x(10), y+boxH)
+	pdf.CellFormat(r.w(85), r.h(5), tmpl.label("guest_sign"), "", 0, "C", false, 0, "")
+	pdf.SetXY(r.x(110), y+boxH)
+	pdf.CellFormat(r.w(85), r.h(5), tmpl.label("desk_sign"), "", 0, "C", false, 0, "")
+	pdf.Ln(r.h(6))
+}
+
+// drawIDPhoto prints the customer's ID photo, for templates that include it
+func (r *templateRenderer) drawIDPhoto() {
+	pdf := r.pdf
+	boxW, boxH := r.w(60), r.w(38)
+	_, pageH := pdf.GetPageSize()
+	if pdf.GetY()+r.h(7)+boxH > pageH-20 {
+		pdf.AddPage()
+	}
+
+	r.font("B", 10)
+	pdf.SetX(r.x(10))
+	pdf.Cell(r.w(60), r.h(6), r.tmpl.label("id_photo"))
+	pdf.Ln(r.h(7))
+	y := pdf.GetY()
+	r.idPhoto(r.x(10), y, boxW, boxH)
+	pdf.SetY(y + boxH)
+	pdf.Ln(r.h(5))
+}
+
+// idPhoto draws the customer's ID photo fitted into a box, or a note when
+// the photo is missing, was purged or the user may not see ID documents
+func (r *templateRenderer) idPhoto(x, y, w, h float64) {
+	pdf := r.pdf
+	pdf.Rect(x, y, w, h, "D")
+
+	note := func(key string) {
+		r.font("I", 8)
+		pdf.SetXY(x, y+h/2-r.h(2))
+		pdf.CellFormat(w, r.h(4), r.tmpl.label(key), "", 0, "C", false, 0, "")
+	}
+	if !can(permViewIDDocuments) {
+		note("id_photo_hidden")
+		return
+	}
+	name, imgW, imgH, ok := r.registerIDPhoto(r.bill.Customer.GovIDPhotoPath)
+	if !ok {
+		note("no_id_photo")
+		return
+	}
+
+	const pad = 1
+	drawW, drawH := w-2*pad, (w-2*pad)*imgH/imgW
+	if drawH > h-2*pad {
+		drawH = h - 2*pad
+		drawW = drawH * imgW / imgH
+	}
+	pdf.ImageOptions(name, x+(w-drawW)/2, y+(h-drawH)/2, drawW, drawH, false,
+		gofpdf.ImageOptions{ImageType: "JPG"}, 0, "")
+}
+
+// registerIDPhoto adds a thumbnail of a stored, possibly encrypted, ID photo
+// to the PDF. Photos that cannot be read are left out rather than failing
+// the document.
+func (r *templateRenderer) registerIDPhoto(path string) (string, float64, float64, bool) {
+	if path == "" {
+		return "", 0, 0, false
+	}
+	data, err := readDataFile(path)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	img, err := decodeRGBA(data)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	thumb, err := encodeIDPhoto(scaleToFit(img, idPhotoThumbSide))
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	name := "id_photo:" + path
+	info := r.pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: "JPG"}, bytes.NewReader(thumb))
+	if info == nil || info.Width() <= 0 || info.Height() <= 0 {
+		return "", 0, 0, false
+	}
+	return name, info.Width(), info.Height(), true
+}
+
+func runRegCardCommand(args []string) error {
+	fs := flag.NewFlagSet("regcard", flag.ContinueOnError)
+	billNumber := fs.String("bill", "", "bill number (required)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", fs.Arg(0))}
+	}
+	if *billNumber == "" {
+		return usageError{"--bill is required"}
+	}
+
+	bill, ok := NewBillDB().getBill(*billNumber)
+	if !ok {
+		return fmt.Errorf("bill %s not found", *billNumber)
+	}
+	path, err := generateRegistrationCard(bill)
+	if err != nil {
+		return err
+	}
+	fmt.Println(path)
+	return nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/jung-kurt/gofpdf"
+)
+
+const guestRegisterDir = "GuestRegister"
+
+// registerEntry is one occupant in the guest register. Guests sharing a
+// stay follow the billed customer and share the stay's details.
+type registerEntry struct {
+	Arrival     time.Time
+	Departure   time.Time
+	BillNumber  string
+	Name        string
+	Relation    string
+	Address     string
+	Nationality string
+	IDType      string
+	IDNumber    string
+	Rooms       string
+	Purpose     string
+	ComingFrom  string
+	GoingTo     string
+}
+
+func (e registerEntry) id() string {
+	if e.IDType == "" {
+		return "-"
+	}
+	return e.IDType + ": " + e.IDNumber
+}
+
+// stayRooms lists the room numbers of a stay, or the room types where no
+// number was recorded
+func stayRooms(bill Bill) string {
+	var rooms []string
+	seen := map[string]bool{}
+	for _, item := range bill.Items {
+		room := item.RoomNumber
+		if room == "" {
+			room = item.Description
+		}
+		if !seen[room] {
+			seen[room] = true
+			rooms = append(rooms, room)
+		}
+	}
+	return strings.Join(rooms, ", ")
+}
+
+// buildGuestRegister lists every occupant of the stays arriving between from
+// and to. ID numbers are masked unless fullIDs is set.
+func buildGuestRegister(bills []Bill, from, to time.Time, settings Settings, fullIDs bool) []registerEntry {
+	from, to = dateOnly(from), dateOnly(to)
+	idNumber := func(idType, number string) string {
+		if fullIDs || number == "" {
+			return number
+		}
+		return settings.maskGovID(idType, number)
+	}
+
+	var stays []Bill
+	for _, bill := range activeBills(bills) {
+		if len(bill.Items) == 0 {
+			continue
+		}
+		arrival := dateOnly(bill.arrival())
+		if !arrival.Before(from) && !arrival.After(to) {
+			stays = append(stays, bill)
+		}
+	}
+	sort.SliceStable(stays, func(i, j int) bool {
+		return stays[i].arrival().Before(stays[j].arrival())
+	})
+
+	var entries []registerEntry
+	for _, bill := range stays {
+		stay := registerEntry{
+			Arrival:     bill.arrival(),
+			Departure:   bill.departure(),
+			BillNumber:  bill.BillNumber,
+			Name:        bill.Customer.Name,
+			Relation:    "Customer",
+			Address:     bill.Customer.Address,
+			Nationality: bill.Customer.nationality(),
+			IDType:      bill.Customer.GovIDType,
+			IDNumber:    idNumber(bill.Customer.GovIDType, bill.Customer.GovIDNumber),
+			Rooms:       stayRooms(bill),
+			Purpose:     bill.Purpose,
+			ComingFrom:  bill.ComingFrom,
+			GoingTo:     bill.GoingTo,
+		}
+		entries = append(entries, stay)
+
+		for _, g := range bill.Guests {
+			guest := stay
+			guest.Name = g.Name + " (" + g.AgeBand + ")"
+			guest.Relation = g.Relation
+			guest.Nationality = g.nationality()
+			guest.IDType = g.GovIDType
+			guest.IDNumber = idNumber(g.GovIDType, g.GovIDNumber)
+			entries = append(entries, guest)
+		}
+	}
+	return entries
+}
+
+var registerColumns = []struct {
+	header string
+	width  float64
+}{
+	{"S.No", 10}, {"Arrival", 22}, {"Departure", 22}, {"Name", 34}, {"Relation", 18},
+	{"Address", 45}, {"Nationality", 20}, {"ID", 38}, {"Room", 18}, {"Purpose", 18},
+	{"Coming From", 16}, {"Going To", 16},
+}
+
+func (e registerEntry) cells(n int) []string {
+	return []string{
+		strconv.Itoa(n), e.Arrival.Format("02-01-2006 15:04"), e.Departure.Format("02-01-2006 15:04"),
+		e.Name, e.Relation, e.Address, e.Nationality, e.id(), e.Rooms, e.Purpose, e.ComingFrom, e.GoingTo,
+	}
+}
+
+// writeGuestRegisterPDF lays the register out on landscape A4 pages with the
+// title and column headings repeated on every page
+func writeGuestRegisterPDF(entries []registerEntry, from, to time.Time, path string) error {
+	pdf := gofpdf.New("L", "mm", "A4", "")
+	pdf.SetFillColor(240, 240, 240)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AliasNbPages("")
+	_, pageH := pdf.GetPageSize()
+
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont("Arial", "B", 13)
+		pdf.CellFormat(277, 7, sellerName+" - Guest Register (Form B)", "", 1, "C", false, 0, "")
+		pdf.SetFont("Arial", "", 9)
+		pdf.CellFormat(277, 5, defaultLabels["property_address"]+"   "+defaultLabels["property_gstin"], "", 1, "C", false, 0, "")
+		pdf.CellFormat(277, 5, fmt.Sprintf("Arrivals from %s to %s", from.Format("02-01-2006"), to.Format("02-01-2006")),
+			"", 1, "C", false, 0, "")
+		pdf.Ln(2)
+		pdf.SetFont("Arial", "B", 8)
+		for _, col := range registerColumns {
+			pdf.CellFormat(col.width, 7, col.header, "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+	})
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Arial", "I", 8)
+		pdf.CellFormat(138, 5, "Generated: "+time.Now().Format("02-01-2006 15:04"), "", 0, "L", false, 0, "")
+		pdf.CellFormat(139, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+
+	pdf.AddPage()
+	pdf.SetFont("Arial", "", 8)
+	if len(entries) == 0 {
+		pdf.CellFormat(277, 8, "No arrivals in this period", "1", 1, "C", false, 0, "")
+	}
+
+	const lineH = 4.0
+	for n, e := range entries {
+		cells := e.cells(n + 1)
+
+		// Long values wrap, and the row is as tall as its longest cell
+		lines := make([][]string, len(cells))
+		rowLines := 1
+		for i, cell := range cells {
+			lines[i] = pdf.SplitText(cell, registerColumns[i].width-2)
+			if len(lines[i]) > rowLines {
+				rowLines = len(lines[i])
+			}
+		}
+		rowH := float64(rowLines)*lineH + 2
+		if pdf.GetY()+rowH > pageH-15 {
+			pdf.AddPage()
+			pdf.SetFont("Arial", "", 8)
+		}
+
+		x, y := pdf.GetX(), pdf.GetY()
+		for i := range cells {
+			w := registerColumns[i].width
+			pdf.Rect(x, y, w, rowH, "D")
+			pdf.SetXY(x+1, y+1)
+			for _, line := range lines[i] {
+				pdf.SetX(x + 1)
+				pdf.CellFormat(w-2, lineH, line, "", 2, "L", false, 0, "")
+			}
+			x += w
+		}
+		pdf.SetXY(10, y+rowH)
+	}
+
+	pdf.Ln(12)
+	if pdf.GetY() > pageH-25 {
+		pdf.AddPage()
+		pdf.Ln(12)
+	}
+	pdf.SetFont("Arial", "", 9)
+	pdf.SetX(200)
+	pdf.CellFormat(80, 5, "Signature of Manager", "T", 1, "C", false, 0, "")
+
+	return pdf.OutputFileAndClose(path)
+}
+
+func writeGuestRegisterCSV(entries []registerEntry, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"s_no", "arrival", "departure", "bill_number", "name", "relation", "address",
+		"nationality", "id_type", "id_number", "rooms", "purpose", "coming_from", "going_to"})
+	for n, e := range entries {
+		w.Write([]string{
+			strconv.Itoa(n + 1), e.Arrival.Format("2006-01-02 15:04"), e.Departure.Format("2006-01-02 15:04"),
+			e.BillNumber, e.Name, e.Relation, e.Address, e.Nationality, e.IDType, e.IDNumber,
+			e.Rooms, e.Purpose, e.ComingFrom, e.GoingTo,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// exportGuestRegister writes the register for a date range as PDF and CSV.
+// Full ID numbers are only exported for staff allowed to view ID documents.
+func exportGuestRegister(bills []Bill, from, to time.Time) ([]registerEntry, string, string, error) {
+	entries := buildGuestRegister(bills, from, to, loadSettings(), can(permViewIDDocuments))
+	if err := os.MkdirAll(guestRegisterDir, 0755); err != nil {
+		return entries, "", "", err
+	}
+
+	base := filepath.Join(guestRegisterDir, fmt.Sprintf("register_%s_%s", from.Format("2006-01-02"), to.Format("2006-01-02")))
+	if err := writeGuestRegisterPDF(entries, dateOnly(from), dateOnly(to), base+".pdf"); err != nil {
+		return entries, "", "", fmt.Errorf("error writing PDF: %v", err)
+	}
+	if err := writeGuestRegisterCSV(entries, base+".csv"); err != nil {
+		return entries, "", "", fmt.Errorf("error writing CSV: %v", err)
+	}
+	return entries, base + ".pdf", base + ".csv", nil
+}
+
+func runRegisterCommand(args []string) error {
+	fs := flag.NewFlagSet("register", flag.ContinueOnError)
+	from := fs.String("from", "", "first arrival date, YYYY-MM-DD (required)")
+	to := fs.String("to", "", "last arrival date, YYYY-MM-DD (default: --from)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", fs.Arg(0))}
+	}
+	if *to == "" {
+		*to = *from
+	}
+
+	fromDate, err := parseCLIDate("from", *from)
+	if err != nil {
+		return err
+	}
+	toDate, err := parseCLIDate("to", *to)
+	if err != nil {
+		return err
+	}
+	if toDate.Before(fromDate) {
+		return usageError{"--to must not be before --from"}
+	}
+
+	entries, pdfPath, csvPath, err := exportGuestRegister(NewBillDB().getBills(), fromDate, toDate)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d guest(s) registered\n", len(entries))
+	fmt.Println(pdfPath)
+	fmt.Println(csvPath)
+	return nil
+}
+
+func showGuestRegisterWindow(myApp fyne.App, billDB *BillDB) {
+	window := myApp.NewWindow("Guest Register")
+
+	now := time.Now()
+	fromDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	toDate := now
+
+	fromDatePicker := widget.NewEntry()
+	fromDatePicker.SetText(fromDate.Format("02-01-2006"))
+	fromDatePicker.Disable()
+
+	toDatePicker := widget.NewEntry()
+	toDatePicker.SetText(toDate.Format("02-01-2006"))
+	toDatePicker.Disable()
+
+	fromDateButton := widget.NewButton("Select From Date", func() {
+		showDatePicker(window, &fromDate, fromDatePicker)
+	})
+
+	toDateButton := widget.NewButton("Select To Date", func() {
+		showDatePicker(window, &toDate, toDatePicker)
+	})
+
+	statusLabel := widget.NewLabel("")
+
+	exportButton := widget.NewButton("Export Register", func() {
+		if dateOnly(toDate).Before(dateOnly(fromDate)) {
+			statusLabel.SetText("To date must be after from date")
+			return
+		}
+		entries, pdfPath, csvPath, err := exportGuestRegister(billDB.getBills(), fromDate, toDate)
+		if err != nil {
+			statusLabel.SetText("Error exporting register: " + err.Error())
+			return
+		}
+		statusLabel.SetText(fmt.Sprintf("%d guest(s) saved to\n%s\n%s", len(entries), pdfPath, csvPath))
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("Arrivals From:"),
+		fromDatePicker,
+		fromDateButton,
+		widget.NewLabel("Arrivals To:"),
+		toDatePicker,
+		toDateButton,
+		exportButton,
+		statusLabel,
+	)
+
+	window.SetContent(container.NewPadded(content))
+	window.Resize(fyne.NewSize(400, 400))
+	window.Show()
+}
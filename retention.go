@@ -0,0 +1,384 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Unreferenced photos younger than this may belong to a customer that is
+// still being added, so they are not treated as orphans yet
+const orphanGracePeriod = 24 * time.Hour
+
+// photoRef is a customer, or a guest on a stay, that an ID photo belongs to
+type photoRef struct {
+	CustomerID string
+	BillNumber string
+	Guest      int
+}
+
+// expiredPhoto is an ID photo past the retention period, of a customer or
+// of another guest on one of their stays. Rebilled stays share the photos of
+// the stay they were copied from, so one photo can have several owners.
+type expiredPhoto struct {
+	Path     string
+	Owner    string
+	Refs     []photoRef
+	LastStay time.Time
+}
+
+// purgePlan lists the ID photos and registration cards a purge would remove
+type purgePlan struct {
+	Months  int
+	Cutoff  time.Time
+	Expired []expiredPhoto
+	Orphans []string
+	Cards   []string
+}
+
+// lastStays returns the last night stayed by each customer, ignoring
+// cancelled bills
+func lastStays(bills []Bill) map[string]time.Time {
+	last := map[string]time.Time{}
+	for _, bill := range activeBills(bills) {
+		for _, item := range bill.Items {
+			if item.ToDate.After(last[bill.Customer.ID]) {
+				last[bill.Customer.ID] = item.ToDate
+			}
+		}
+	}
+	return last
+}
+
+// buildPurgePlan finds the photos of customers whose last stay, or
+// registration if they never stayed, is more than months before now, the
+// files in the photo directory that no customer or stay refers to and the
+// registration cards printed more than a day ago
+func buildPurgePlan(customers []Customer, bills []Bill, months int, now time.Time) (purgePlan, error) {
+	plan := purgePlan{Months: months, Cutoff: dateOnly(now).AddDate(0, -months, 0)}
+
+	// A photo is kept for as long as its latest owner needs it
+	photos := map[string]*expiredPhoto{}
+	var paths []string
+	use := func(path, owner string, ref photoRef, lastStay time.Time) {
+		path = filepath.Clean(path)
+		p, ok := photos[path]
+		if !ok {
+			p = &expiredPhoto{Path: path}
+			photos[path] = p
+			paths = append(paths, path)
+		}
+		p.Refs = append(p.Refs, ref)
+		if len(p.Refs) == 1 || lastStay.After(p.LastStay) {
+			p.Owner = owner
+			p.LastStay = lastStay
+		}
+	}
+
+	last := lastStays(bills)
+	for _, c := range customers {
+		if c.GovIDPhotoPath == "" {
+			continue
+		}
+		lastStay, ok := last[c.ID]
+		if !ok {
+			lastStay = c.AddedOn
+		}
+		use(c.GovIDPhotoPath, c.ID+"  "+c.Name, photoRef{CustomerID: c.ID}, lastStay)
+	}
+
+	// Guests' photos expire with the stay they were taken for
+	for _, bill := range bills {
+		stayEnd := time.Time{}
+		for _, item := range bill.Items {
+			if item.ToDate.After(stayEnd) {
+				stayEnd = item.ToDate
+			}
+		}
+		for i, g := range bill.Guests {
+			if g.GovIDPhotoPath == "" {
+				continue
+			}
+			use(g.GovIDPhotoPath, g.Name+" (guest on "+bill.BillNumber+")",
+				photoRef{BillNumber: bill.BillNumber, Guest: i}, stayEnd)
+		}
+	}
+
+	for _, path := range paths {
+		if p := photos[path]; months > 0 && dateOnly(p.LastStay).Before(plan.Cutoff) {
+			plan.Expired = append(plan.Expired, *p)
+		}
+	}
+	sort.SliceStable(plan.Expired, func(i, j int) bool {
+		return plan.Expired[i].LastStay.Before(plan.Expired[j].LastStay)
+	})
+
+	files, err := os.ReadDir(idPhotosDir)
+	if err != nil && !os.IsNotExist(err) {
+		return plan, err
+	}
+	for _, f := range files {
+		path := filepath.Join(idPhotosDir, f.Name())
+		if f.IsDir() || photos[path] != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil || now.Sub(info.ModTime()) < orphanGracePeriod {
+			continue
+		}
+		plan.Orphans = append(plan.Orphans, path)
+	}
+
+	// Cards carry the guest's ID photo and can be printed again from the bill
+	cards, err := os.ReadDir(regCardDir)
+	if err != nil && !os.IsNotExist(err) {
+		return plan, err
+	}
+	for _, f := range cards {
+		info, err := f.Info()
+		if f.IsDir() || err != nil || now.Sub(info.ModTime()) < orphanGracePeriod {
+			continue
+		}
+		plan.Cards = append(plan.Cards, filepath.Join(regCardDir, f.Name()))
+	}
+	return plan, nil
+}
+
+func (p purgePlan) empty() bool {
+	return len(p.Expired) == 0 && len(p.Orphans) == 0 && len(p.Cards) == 0
+}
+
+func (p purgePlan) size() int {
+	return len(p.Expired) + len(p.Orphans) + len(p.Cards)
+}
+
+// writeReport prints what the purge removes, for the dry run
+func (p purgePlan) writeReport(w io.Writer) {
+	if p.Months > 0 {
+		fmt.Fprintf(w, "ID photos of guests whose last stay was before %s (%d months):\n",
+			p.Cutoff.Format("02-01-2006"), p.Months)
+		for _, e := range p.Expired {
+			fmt.Fprintf(w, "  %s  last stay %s  %s\n", e.Owner, e.LastStay.Format("02-01-2006"), e.Path)
+		}
+		if len(p.Expired) == 0 {
+			fmt.Fprintln(w, "  none")
+		}
+	} else {
+		fmt.Fprintln(w, "No retention period is set, ID photos of guests are kept.")
+	}
+	fmt.Fprintln(w, "Orphaned photos not referenced by any customer or stay:")
+	for _, path := range p.Orphans {
+		fmt.Fprintf(w, "  %s\n", path)
+	}
+	if len(p.Orphans) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	fmt.Fprintln(w, "Registration cards printed more than a day ago:")
+	for _, path := range p.Cards {
+		fmt.Fprintf(w, "  %s\n", path)
+	}
+	if len(p.Cards) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+}
+
+// executePurge deletes the photos and cards in the plan, clears the photos
+// from the customers and bills and records every deletion in the audit log
+func executePurge(plan purgePlan, db *CustomerDB, billDB *BillDB) (int, error) {
+	removed := 0
+	for _, e := range plan.Expired {
+		detail := map[string]string{
+			"owner":     e.Owner,
+			"path":      e.Path,
+			"last_stay": e.LastStay.Format("2006-01-02"),
+			"reason":    fmt.Sprintf("retention period of %d months", plan.Months),
+		}
+		if err := logChange(auditDelete, auditIDPhoto, e.Path, detail, nil, func() error {
+			return removePhoto(e.Path)
+		}); err != nil {
+			return removed, err
+		}
+		if err := clearPhotoPath(e, db, billDB); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	for _, path := range plan.Orphans {
+		detail := map[string]string{"path": path, "reason": "not referenced by any customer or stay"}
+		if err := logChange(auditDelete, auditIDPhoto, path, detail, nil, func() error {
+			return removePhoto(path)
+		}); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	for _, path := range plan.Cards {
+		detail := map[string]string{"path": path, "reason": "registration card already printed"}
+		if err := logChange(auditDelete, auditRegCard, path, detail, nil, func() error {
+			return removePhoto(path)
+		}); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func removePhoto(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// clearPhotoPath removes a purged photo from its customers and bills
+func clearPhotoPath(e expiredPhoto, db *CustomerDB, billDB *BillDB) error {
+	for _, ref := range e.Refs {
+		if err := clearPhotoRef(ref, db, billDB); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clearPhotoRef(ref photoRef, db *CustomerDB, billDB *BillDB) error {
+	if ref.CustomerID != "" {
+		customer, ok := db.getCustomer(ref.CustomerID)
+		if !ok {
+			return nil
+		}
+		customer.GovIDPhotoPath = ""
+		return db.updateCustomer(customer)
+	}
+
+	if _, ok := billDB.getBill(ref.BillNumber); !ok {
+		return nil
+	}
+	return billDB.updateBill(ref.BillNumber, func(bill *Bill) error {
+		if ref.Guest < len(bill.Guests) {
+			guests := append([]StayGuest{}, bill.Guests...)
+			guests[ref.Guest].GovIDPhotoPath = ""
+			bill.Guests = guests
+		}
+		return nil
+	})
+}
+
+func runPurgePhotosCommand(args []string) error {
+	fs := flag.NewFlagSet("purge-photos", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report the photos that would be removed")
+	months := fs.Int("months", -1, "retention period in months (default: the period set in Settings)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Sprintf("unexpected argument %q", fs.Arg(0))}
+	}
+	if *months < 0 {
+		*months = loadSettings().IDPhotoRetentionMonths
+	}
+
+	db := NewCustomerDB()
+	billDB := NewBillDB()
+	if db.loadErr != nil {
+		return db.loadErr
+	}
+	if billDB.loadErr != nil {
+		return billDB.loadErr
+	}
+
+	plan, err := buildPurgePlan(db.getCustomers(), billDB.getBills(), *months, time.Now())
+	if err != nil {
+		return err
+	}
+	plan.writeReport(os.Stdout)
+	if *dryRun || plan.empty() {
+		return nil
+	}
+
+	removed, err := executePurge(plan, db, billDB)
+	fmt.Printf("%d file(s) removed\n", removed)
+	return err
+}
+
+func showPhotoRetentionWindow(myApp fyne.App, db *CustomerDB, billDB *BillDB) {
+	window := myApp.NewWindow("ID Photo Retention")
+	settings := loadSettings()
+
+	reportLabel := widget.NewLabel("")
+	statusLabel := widget.NewLabel("")
+
+	var plan purgePlan
+	dryRun := func() {
+		var err error
+		plan, err = buildPurgePlan(db.getCustomers(), billDB.getBills(), settings.IDPhotoRetentionMonths, time.Now())
+		if err != nil {
+			statusLabel.SetText("Error checking ID photos: " + err.Error())
+			return
+		}
+		var report strings.Builder
+		plan.writeReport(&report)
+		reportLabel.SetText(report.String())
+		statusLabel.SetText(fmt.Sprintf("%d expired and %d orphaned photo(s) and %d registration card(s) would be removed",
+			len(plan.Expired), len(plan.Orphans), len(plan.Cards)))
+	}
+
+	dryRunButton := widget.NewButton("Refresh Report", dryRun)
+
+	purgeButton := widget.NewButton("Purge Photos", func() {
+		if !requirePermission(window, permManageSettings) {
+			return
+		}
+		if plan.empty() {
+			statusLabel.SetText("There are no photos or cards to remove")
+			return
+		}
+		dialog.ShowConfirm("Purge ID Photos",
+			fmt.Sprintf("Permanently delete %d ID photo(s) and registration card(s)?", plan.size()),
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				removed, err := executePurge(plan, db, billDB)
+				dryRun()
+				if err != nil {
+					statusLabel.SetText(fmt.Sprintf("%d file(s) removed before an error: %v", removed, err))
+					return
+				}
+				statusLabel.SetText(fmt.Sprintf("%d file(s) removed", removed))
+			}, window)
+	})
+
+	dryRun()
+
+	period := "not set, guests' ID photos are kept"
+	if settings.IDPhotoRetentionMonths > 0 {
+		period = fmt.Sprintf("%d months after the last stay", settings.IDPhotoRetentionMonths)
+	}
+
+	top := container.NewVBox(
+		widget.NewLabel("Retention period: "+period+" (change it in Settings)"),
+		container.NewGridWithColumns(2, dryRunButton, purgeButton),
+		statusLabel,
+	)
+
+	window.SetContent(container.NewPadded(container.NewBorder(top, nil, nil, nil, container.NewVScroll(reportLabel))))
+	window.Resize(fyne.NewSize(650, 500))
+	window.Show()
+}
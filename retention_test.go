@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPurgePlanKeepsPhotoOfRebilledStay(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+	stay := func(number string, end time.Time) Bill {
+		return Bill{
+			BillNumber: number,
+			Customer:   Customer{ID: "CUST1"},
+			Items:      []RentalItem{{FromDate: end.AddDate(0, 0, -2), ToDate: end}},
+			Guests:     []StayGuest{{Name: "Meera", GovIDPhotoPath: "customer_data/id_photos/id_1.jpg"}},
+		}
+	}
+	old := stay("B1", now.AddDate(-2, 0, 0))
+	rebilled := stay("B2", now.AddDate(0, -1, 0))
+
+	plan, err := buildPurgePlan(nil, []Bill{old, rebilled}, 12, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Expired) != 0 {
+		t.Fatalf("photo still used by %s is purged: %+v", rebilled.BillNumber, plan.Expired)
+	}
+
+	rebilled = stay("B2", now.AddDate(-1, -1, 0))
+	plan, err = buildPurgePlan(nil, []Bill{old, rebilled}, 12, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Expired) != 1 || len(plan.Expired[0].Refs) != 2 {
+		t.Fatalf("expired = %+v, want the photo once with both stays", plan.Expired)
+	}
+	if got := plan.Expired[0].LastStay; !got.Equal(rebilled.Items[0].ToDate) {
+		t.Errorf("last stay = %v, want the end of %s", got, rebilled.BillNumber)
+	}
+}
+
+func TestPurgePlanRemovesPrintedRegistrationCards(t *testing.T) {
+	inTempDir(t)
+	now := time.Now()
+	if err := os.MkdirAll(regCardDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, number := range []string{"B1", "B2"} {
+		if err := ioutil.WriteFile(regCardPath(number), []byte("%PDF"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	printed := now.Add(-2 * orphanGracePeriod)
+	if err := os.Chtimes(regCardPath("B1"), printed, printed); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := buildPurgePlan(nil, nil, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Cards) != 1 || plan.Cards[0] != regCardPath("B1") {
+		t.Fatalf("cards = %v, want only the one printed two days ago", plan.Cards)
+	}
+
+	if _, err := executePurge(plan, NewCustomerDB(), NewBillDB()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(regCardPath("B1")); !os.IsNotExist(err) {
+		t.Errorf("printed card still on disk: %v", err)
+	}
+	if _, err := os.Stat(regCardPath("B2")); err != nil {
+		t.Errorf("card printed today was removed: %v", err)
+	}
+}
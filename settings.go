@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+const settingsFilePath = "customer_data/settings.json"
+
+// Settings holds property-level configuration edited from the Settings window
+type Settings struct {
+	UPIVPA          string `json:"upi_vpa"`
+	UPIPayeeName    string `json:"upi_payee_name"`
+	InvoiceTemplate string `json:"invoice_template"`
+	APIToken        string `json:"api_token,omitempty"`
+	// RoomInventory is the number of rooms of each room type
+	RoomInventory map[string]int `json:"room_inventory,omitempty"`
+	// IDMaskRules decide how ID numbers are shown, by ID type
+	IDMaskRules map[string]idMaskRule `json:"id_mask_rules,omitempty"`
+	// RoomRates are the standard nightly rates, by room type. Only staff
+	// allowed to edit rates can bill a different rate.
+	RoomRates map[string]float64 `json:"room_rates,omitempty"`
+	// IDPhotoRetentionMonths is how long ID photos are kept after a guest's
+	// last stay; 0 keeps them
+	IDPhotoRetentionMonths int `json:"id_photo_retention_months,omitempty"`
+	// IDCaptureFolder is where a scanner or phone sync drops ID photos
+	IDCaptureFolder string `json:"id_capture_folder,omitempty"`
+	// WebcamDevice is the V4L2 device ID photos are taken with, on Linux
+	WebcamDevice string `json:"webcam_device,omitempty"`
+}
+
+var vpaPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{2,256}@[A-Za-z]{2,64}$`)
+
+// loadSettings returns the saved settings, or defaults if none are saved yet
+func loadSettings() Settings {
+	settings := Settings{
+		UPIPayeeName:    sellerName,
+		InvoiceTemplate: builtinTemplates[0].Name,
+	}
+	data, err := ioutil.ReadFile(settingsFilePath)
+	if err != nil {
+		return settings
+	}
+	json.Unmarshal(data, &settings)
+	return settings
+}
+
+func saveSettings(settings Settings) error {
+	return withDataLock(func() error {
+		before := loadSettings()
+		data, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return err
+		}
+		save := func() error {
+			return writeFileAtomic(settingsFilePath, data, 0644)
+		}
+
+		// Rate and settings changes get an entry each, both written before
+		// the file is saved
+		if valuesDiffer(auditSettingsValue(before), auditSettingsValue(settings)) || before.APIToken != settings.APIToken {
+			after := auditSettingsValue(settings)
+			if before.APIToken != settings.APIToken {
+				after.APIToken = "(changed)"
+			}
+			write := save
+			save = func() error {
+				return logChangeLocked(auditUpdate, auditSettings, "settings", auditSettingsValue(before), after, write)
+			}
+		}
+		if (len(before.RoomRates) > 0 || len(settings.RoomRates) > 0) && valuesDiffer(before.RoomRates, settings.RoomRates) {
+			return logChangeLocked(auditUpdate, auditRates, "room_rates", before.RoomRates, settings.RoomRates, save)
+		}
+		return save()
+	})
+}
+
+func showSettingsWindow(myApp fyne.App) {
+	window := myApp.NewWindow("Settings")
+	settings := loadSettings()
+
+	vpaEntry := widget.NewEntry()
+	vpaEntry.SetPlaceHolder("UPI ID (e.g. trinitystays@okaxis)")
+	vpaEntry.SetText(settings.UPIVPA)
+
+	payeeEntry := widget.NewEntry()
+	payeeEntry.SetPlaceHolder("UPI Payee Name")
+	payeeEntry.SetText(settings.UPIPayeeName)
+
+	templates := availableTemplates()
+	templateNames := make([]string, len(templates))
+	for i, tmpl := range templates {
+		templateNames[i] = tmpl.Name
+	}
+	templateSelect := widget.NewSelect(templateNames, nil)
+	templateSelect.SetSelected(findTemplate(settings.InvoiceTemplate).Name)
+
+	tokenEntry := widget.NewPasswordEntry()
+	tokenEntry.SetPlaceHolder("API Token")
+	tokenEntry.SetText(settings.APIToken)
+
+	generateTokenButton := widget.NewButton("Generate API Token", func() {
+		token, err := newAPIToken()
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		tokenEntry.SetText(token)
+		dialog.ShowInformation("API Token", "Copy this token to the booking website and tablet:\n\n"+token, window)
+	})
+
+	inventoryEntries := make([]*widget.Entry, len(roomTypes))
+	inventoryForm := container.NewGridWithColumns(2)
+	for i, roomType := range roomTypes {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("0")
+		if n := settings.RoomInventory[roomType]; n > 0 {
+			entry.SetText(strconv.Itoa(n))
+		}
+		inventoryEntries[i] = entry
+		inventoryForm.Add(widget.NewLabel(roomType + "s:"))
+		inventoryForm.Add(entry)
+	}
+
+	maskSelects := make([]*widget.Select, len(govIDTypes))
+	maskForm := container.NewGridWithColumns(2)
+	for i, idType := range govIDTypes {
+		sel := widget.NewSelect(idMaskLabels(idType), nil)
+		sel.SetSelected(idMaskLabel(settings.idMaskRule(idType)))
+		maskSelects[i] = sel
+		maskForm.Add(widget.NewLabel(idType + ":"))
+		maskForm.Add(sel)
+	}
+
+	retentionEntry := widget.NewEntry()
+	retentionEntry.SetPlaceHolder("Months after last stay (blank to keep)")
+	if settings.IDPhotoRetentionMonths > 0 {
+		retentionEntry.SetText(strconv.Itoa(settings.IDPhotoRetentionMonths))
+	}
+
+	captureFolderEntry := widget.NewEntry()
+	captureFolderEntry.SetPlaceHolder("Scan folder (blank if none)")
+	captureFolderEntry.SetText(settings.IDCaptureFolder)
+
+	webcamEntry := widget.NewEntry()
+	webcamEntry.SetPlaceHolder("Webcam device, e.g. /dev/video0 (blank if none)")
+	webcamEntry.SetText(settings.WebcamDevice)
+	if !webcamSupported {
+		webcamEntry.Hide()
+	}
+
+	statusLabel := widget.NewLabel("")
+
+	saveButton := widget.NewButton("Save Settings", func() {
+		if !requirePermission(window, permManageSettings) {
+			return
+		}
+		vpa := strings.TrimSpace(vpaEntry.Text)
+		if vpa != "" && !vpaPattern.MatchString(vpa) {
+			statusLabel.SetText("Please enter a valid UPI ID")
+			return
+		}
+
+		settings.UPIVPA = vpa
+		settings.UPIPayeeName = strings.TrimSpace(payeeEntry.Text)
+		settings.InvoiceTemplate = templateSelect.Selected
+		token := strings.TrimSpace(tokenEntry.Text)
+		if token != "" && len(token) < minAPITokenLength {
+			statusLabel.SetText(fmt.Sprintf("API token must be at least %d characters", minAPITokenLength))
+			return
+		}
+		settings.APIToken = token
+
+		inventory := map[string]int{}
+		for i, roomType := range roomTypes {
+			text := strings.TrimSpace(inventoryEntries[i].Text)
+			if text == "" {
+				continue
+			}
+			n, err := strconv.Atoi(text)
+			if err != nil || n < 0 {
+				statusLabel.SetText("Please enter a valid number of " + roomType + "s")
+				return
+			}
+			inventory[roomType] = n
+		}
+		settings.RoomInventory = inventory
+
+		rules := map[string]idMaskRule{}
+		for i, idType := range govIDTypes {
+			rules[idType] = idMaskRuleFromLabel(maskSelects[i].Selected)
+		}
+		settings.IDMaskRules = rules
+
+		settings.IDPhotoRetentionMonths = 0
+		if text := strings.TrimSpace(retentionEntry.Text); text != "" {
+			months, err := strconv.Atoi(text)
+			if err != nil || months < 0 {
+				statusLabel.SetText("Please enter a valid number of months to keep ID photos")
+				return
+			}
+			settings.IDPhotoRetentionMonths = months
+		}
+
+		settings.IDCaptureFolder = strings.TrimSpace(captureFolderEntry.Text)
+		if settings.IDCaptureFolder != "" {
+			if info, err := os.Stat(settings.IDCaptureFolder); err != nil || !info.IsDir() {
+				statusLabel.SetText("Scan folder " + settings.IDCaptureFolder + " does not exist")
+				return
+			}
+		}
+		settings.WebcamDevice = strings.TrimSpace(webcamEntry.Text)
+		// Room rates are edited in their own window
+		settings.RoomRates = loadSettings().RoomRates
+
+		if err := saveSettings(settings); err != nil {
+			statusLabel.SetText("Error saving settings: " + err.Error())
+			return
+		}
+		statusLabel.SetText("Settings saved successfully!")
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("UPI Payments:"),
+		vpaEntry,
+		payeeEntry,
+		widget.NewLabel("Invoice Template:"),
+		templateSelect,
+		widget.NewLabel("API Server:"),
+		tokenEntry,
+		generateTokenButton,
+		widget.NewLabel("Number of Rooms:"),
+		inventoryForm,
+		widget.NewLabel("ID Numbers Shown:"),
+		maskForm,
+		widget.NewLabel("Purge ID Photos After:"),
+		retentionEntry,
+		widget.NewLabel("ID Photo Capture:"),
+		captureFolderEntry,
+		webcamEntry,
+		saveButton,
+		statusLabel,
+	)
+
+	window.SetContent(container.NewPadded(container.NewVScroll(content)))
+	window.Resize(fyne.NewSize(450, 650))
+	window.Show()
+}
+
+// checkRoomRate stops staff who may not edit rates from billing a room at
+// anything other than its standard rate
+func (s Settings) checkRoomRate(item RentalItem) error {
+	standard, ok := s.RoomRates[item.Description]
+	if !ok || item.Rate == standard || can(permEditRates) {
+		return nil
+	}
+	return fmt.Errorf("%s must be billed at the standard rate of ₹%.2f", item.Description, standard)
+}
+
+func showRoomRatesWindow(myApp fyne.App) {
+	window := myApp.NewWindow("Room Rates")
+	settings := loadSettings()
+
+	rateEntries := make([]*widget.Entry, len(roomTypes))
+	ratesForm := container.NewGridWithColumns(2)
+	for i, roomType := range roomTypes {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("Not set")
+		if rate, ok := settings.RoomRates[roomType]; ok {
+			entry.SetText(strconv.FormatFloat(rate, 'f', 2, 64))
+		}
+		rateEntries[i] = entry
+		ratesForm.Add(widget.NewLabel(roomType + ":"))
+		ratesForm.Add(entry)
+	}
+
+	statusLabel := widget.NewLabel("")
+
+	saveButton := widget.NewButton("Save Rates", func() {
+		if !requirePermission(window, permEditRates) {
+			return
+		}
+		rates := map[string]float64{}
+		for i, roomType := range roomTypes {
+			text := strings.TrimSpace(rateEntries[i].Text)
+			if text == "" {
+				continue
+			}
+			rate, err := strconv.ParseFloat(text, 64)
+			if err != nil || rate <= 0 {
+				statusLabel.SetText("Please enter a valid rate for " + roomType)
+				return
+			}
+			rates[roomType] = rate
+		}
+
+		// Reload so that changes made in Settings meanwhile are kept
+		settings = loadSettings()
+		settings.RoomRates = rates
+		if err := saveSettings(settings); err != nil {
+			statusLabel.SetText("Error saving rates: " + err.Error())
+			return
+		}
+		statusLabel.SetText("Rates saved successfully!")
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("Standard Rate per Day:"),
+		ratesForm,
+		saveButton,
+		statusLabel,
+	)
+
+	window.SetContent(container.NewPadded(content))
+	window.Resize(fyne.NewSize(350, 250))
+	window.Show()
+}
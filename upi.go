@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// upiPayURI builds a upi://pay link that pre-fills the payee and amount in
+// any UPI app. The bill number goes in the note and the transaction ref.
+func upiPayURI(vpa, payeeName string, amount float64, billNumber string) string {
+	escape := func(s string) string {
+		s = strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+		return strings.ReplaceAll(s, "%40", "@")
+	}
+	return fmt.Sprintf("upi://pay?pa=%s&pn=%s&am=%.2f&cu=INR&tn=%s&tr=%s",
+		escape(vpa), escape(payeeName), amount, escape("Bill "+billNumber), escape(billNumber))
+}
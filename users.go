@@ -0,0 +1,517 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 8
+
+type permission string
+
+const (
+	permAddCustomers    permission = "add_customers"
+	permCreateBills     permission = "create_bills"
+	permCancelBills     permission = "cancel_bills"
+	permRecordPayments  permission = "record_payments"
+	permEditRates       permission = "edit_rates"
+	permViewIDDocuments permission = "view_id_documents"
+	permExportData      permission = "export_data"
+	permManageSettings  permission = "manage_settings"
+	permManageUsers     permission = "manage_users"
+	permViewAuditLog    permission = "view_audit_log"
+)
+
+const (
+	roleFrontDesk  = "front_desk"
+	roleManager    = "manager"
+	roleAccountant = "accountant"
+	roleAdmin      = "admin"
+)
+
+var roles = []string{roleFrontDesk, roleManager, roleAccountant, roleAdmin}
+
+var roleLabels = map[string]string{
+	roleFrontDesk:  "Front Desk",
+	roleManager:    "Manager",
+	roleAccountant: "Accountant",
+	roleAdmin:      "Admin",
+}
+
+var rolePermissions = map[string][]permission{
+	roleFrontDesk: {permAddCustomers, permCreateBills, permRecordPayments},
+	roleManager: {permAddCustomers, permCreateBills, permCancelBills, permRecordPayments, permEditRates,
+		permViewIDDocuments, permExportData, permViewAuditLog},
+	roleAccountant: {permExportData, permViewAuditLog},
+	roleAdmin: {permAddCustomers, permCreateBills, permCancelBills, permRecordPayments, permEditRates,
+		permViewIDDocuments, permExportData, permManageSettings, permManageUsers, permViewAuditLog},
+}
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{3,32}$`)
+
+// User is a staff account of the desktop application
+type User struct {
+	Username     string    `json:"username"`
+	Name         string    `json:"name"`
+	Role         string    `json:"role"`
+	PasswordHash string    `json:"password_hash"`
+	Disabled     bool      `json:"disabled,omitempty"`
+	AddedOn      time.Time `json:"added_on"`
+}
+
+// currentUser is the staff member logged in to the desktop app or running
+// a command, or the system user that the API runs as
+var currentUser *User
+
+// apiUser is the system user of the API server, whose clients log in with
+// the API token instead
+var apiUser = User{Username: "api", Name: "HTTP API", Role: roleFrontDesk}
+
+func (u User) can(p permission) bool {
+	if u.Disabled {
+		return false
+	}
+	for _, granted := range rolePermissions[u.Role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// can reports whether the current user has a permission
+func can(p permission) bool {
+	return currentUser != nil && currentUser.can(p)
+}
+
+// actingUser is recorded on the customers and bills the current user creates
+func actingUser() string {
+	if currentUser == nil {
+		return ""
+	}
+	return currentUser.Username
+}
+
+func (u User) label() string {
+	text := fmt.Sprintf("%s - %s (%s)", u.Username, u.Name, roleLabels[u.Role])
+	if u.Disabled {
+		text += " [disabled]"
+	}
+	return text
+}
+
+// UserDB handles storage of staff accounts
+type UserDB struct {
+	users    []User
+	filePath string
+}
+
+func NewUserDB() *UserDB {
+	os.MkdirAll("customer_data", 0755)
+
+	db := &UserDB{
+		filePath: "customer_data/users.json",
+	}
+	db.loadUsers()
+	return db
+}
+
+func (db *UserDB) loadUsers() error {
+	db.users = nil
+	data, err := ioutil.ReadFile(db.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &db.users)
+}
+
+func (db *UserDB) saveUsers() error {
+	data, err := json.MarshalIndent(db.users, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(db.filePath, data, 0600)
+}
+
+// change runs fn under the data lock on the users as saved on disk
+func (db *UserDB) change(fn func() error) error {
+	return withDataLock(func() error {
+		if err := db.loadUsers(); err != nil {
+			return fmt.Errorf("users could not be loaded: %v", err)
+		}
+		return fn()
+	})
+}
+
+func (db *UserDB) getUsers() []User {
+	return db.users
+}
+
+func (db *UserDB) getUser(username string) (User, bool) {
+	for _, u := range db.users {
+		if u.Username == username {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (db *UserDB) addUser(username, name, role, password string) error {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("username must be 3-32 lower-case letters, digits, dots, dashes or underscores")
+	}
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("please enter the staff member's name")
+	}
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("please select a role")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	user := User{
+		Username:     username,
+		Name:         strings.TrimSpace(name),
+		Role:         role,
+		PasswordHash: hash,
+		AddedOn:      time.Now(),
+	}
+	return db.change(func() error {
+		if _, exists := db.getUser(username); exists {
+			return fmt.Errorf("user %s already exists", username)
+		}
+		db.users = append(db.users, user)
+		return logChangeLocked(auditCreate, auditUser, username, nil, auditUserValue(user), db.saveUsers)
+	})
+}
+
+// updateUser replaces a saved user, refusing changes that would leave no
+// active admin to manage the accounts
+func (db *UserDB) updateUser(user User) error {
+	return db.change(func() error {
+		admins := 0
+		found := false
+		for _, u := range db.users {
+			if u.Username == user.Username {
+				u = user
+				found = true
+			}
+			if u.Role == roleAdmin && !u.Disabled {
+				admins++
+			}
+		}
+		if !found {
+			return fmt.Errorf("user %s not found", user.Username)
+		}
+		if admins == 0 {
+			return fmt.Errorf("at least one active admin account is required")
+		}
+
+		var before User
+		for i, u := range db.users {
+			if u.Username == user.Username {
+				before = u
+				db.users[i] = user
+			}
+		}
+		after := auditUserValue(user)
+		if user.PasswordHash != before.PasswordHash {
+			after.PasswordHash = "(changed)"
+		}
+		return logChangeLocked(auditUpdate, auditUser, user.Username, auditUserValue(before), after, db.saveUsers)
+	})
+}
+
+// authenticate returns the user for a correct username and password
+func (db *UserDB) authenticate(username, password string) (User, error) {
+	user, ok := db.getUser(strings.ToLower(strings.TrimSpace(username)))
+	if !ok || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return User{}, fmt.Errorf("invalid username or password")
+	}
+	if user.Disabled {
+		return User{}, fmt.Errorf("this account has been disabled")
+	}
+	return user, nil
+}
+
+// hasBusinessData reports whether customers or bills have been saved, or
+// cannot be read, so that a missing users file is not taken for a first run
+func hasBusinessData() bool {
+	db := NewCustomerDB()
+	billDB := NewBillDB()
+	return db.loadErr != nil || billDB.loadErr != nil ||
+		len(db.getCustomers()) > 0 || len(billDB.getBills()) > 0
+}
+
+// showLoginScreen asks for a username and password before continuing with
+// next. On the first run it creates the admin account instead.
+func showLoginScreen(window fyne.Window, userDB *UserDB, next func()) {
+	usernameEntry := widget.NewEntry()
+	usernameEntry.SetPlaceHolder("Username")
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Password")
+	statusLabel := widget.NewLabel("")
+
+	// Without staff accounts anyone could create an admin account, so this
+	// is only offered before any customer or bill has been saved
+	if len(userDB.getUsers()) == 0 && hasBusinessData() {
+		window.SetContent(container.NewPadded(container.NewVBox(
+			widget.NewLabel("No staff accounts were found, but customer data exists."),
+			widget.NewLabel("Restore "+userDB.filePath+" from a backup to log in."),
+		)))
+		return
+	}
+
+	if len(userDB.getUsers()) == 0 {
+		nameEntry := widget.NewEntry()
+		nameEntry.SetPlaceHolder("Your Name")
+		confirmEntry := widget.NewPasswordEntry()
+		confirmEntry.SetPlaceHolder("Confirm Password")
+
+		createButton := widget.NewButton("Create Admin Account", func() {
+			if passwordEntry.Text != confirmEntry.Text {
+				statusLabel.SetText("Passwords do not match")
+				return
+			}
+			if hasBusinessData() {
+				statusLabel.SetText("Customer data exists, restore " + userDB.filePath + " from a backup")
+				return
+			}
+			if err := userDB.addUser(usernameEntry.Text, nameEntry.Text, roleAdmin, passwordEntry.Text); err != nil {
+				statusLabel.SetText(err.Error())
+				return
+			}
+			user, _ := userDB.getUser(strings.ToLower(strings.TrimSpace(usernameEntry.Text)))
+			currentUser = &user
+			next()
+		})
+
+		window.SetContent(container.NewPadded(container.NewVBox(
+			widget.NewLabel("Create the admin account to get started:"),
+			usernameEntry,
+			nameEntry,
+			passwordEntry,
+			confirmEntry,
+			createButton,
+			statusLabel,
+		)))
+		return
+	}
+
+	loginButton := widget.NewButton("Log In", func() {
+		user, err := userDB.authenticate(usernameEntry.Text, passwordEntry.Text)
+		if err != nil {
+			passwordEntry.SetText("")
+			statusLabel.SetText(err.Error())
+			return
+		}
+		currentUser = &user
+		next()
+	})
+	passwordEntry.OnSubmitted = func(string) { loginButton.OnTapped() }
+
+	window.SetContent(container.NewPadded(container.NewVBox(
+		widget.NewLabel("Staff Login"),
+		usernameEntry,
+		passwordEntry,
+		loginButton,
+		statusLabel,
+	)))
+}
+
+func roleOptions() []string {
+	options := make([]string, len(roles))
+	for i, role := range roles {
+		options[i] = roleLabels[role]
+	}
+	return options
+}
+
+func roleFromLabel(label string) string {
+	for role, l := range roleLabels {
+		if l == label {
+			return role
+		}
+	}
+	return ""
+}
+
+func showUsersWindow(myApp fyne.App, userDB *UserDB) {
+	window := myApp.NewWindow("Staff Accounts")
+
+	users := userDB.getUsers()
+	var selected *User
+
+	usersList := widget.NewList(
+		func() int { return len(users) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(users[i].label())
+		},
+	)
+
+	statusLabel := widget.NewLabel("")
+	refresh := func() {
+		users = userDB.getUsers()
+		usersList.Refresh()
+	}
+
+	// Editing the selected user
+	editRoleSelect := widget.NewSelect(roleOptions(), nil)
+	resetPasswordEntry := widget.NewPasswordEntry()
+	resetPasswordEntry.SetPlaceHolder("New Password")
+	var toggleButton *widget.Button
+
+	usersList.OnSelected = func(i widget.ListItemID) {
+		user := users[i]
+		selected = &user
+		editRoleSelect.SetSelected(roleLabels[user.Role])
+		if user.Disabled {
+			toggleButton.SetText("Enable Account")
+		} else {
+			toggleButton.SetText("Disable Account")
+		}
+	}
+
+	update := func(change func(u *User) error, done string) {
+		if !requirePermission(window, permManageUsers) {
+			return
+		}
+		if selected == nil {
+			statusLabel.SetText("Please select a user")
+			return
+		}
+		user := *selected
+		if err := change(&user); err != nil {
+			statusLabel.SetText(err.Error())
+			return
+		}
+		if err := userDB.updateUser(user); err != nil {
+			statusLabel.SetText("Error saving user: " + err.Error())
+			return
+		}
+		selected = &user
+		refresh()
+		statusLabel.SetText(done)
+	}
+
+	saveRoleButton := widget.NewButton("Change Role", func() {
+		update(func(u *User) error {
+			u.Role = roleFromLabel(editRoleSelect.Selected)
+			if u.Role == "" {
+				return fmt.Errorf("please select a role")
+			}
+			return nil
+		}, "Role changed successfully!")
+	})
+
+	resetPasswordButton := widget.NewButton("Reset Password", func() {
+		update(func(u *User) error {
+			hash, err := hashPassword(resetPasswordEntry.Text)
+			if err != nil {
+				return err
+			}
+			u.PasswordHash = hash
+			return nil
+		}, "Password reset successfully!")
+		resetPasswordEntry.SetText("")
+	})
+
+	toggleButton = widget.NewButton("Disable Account", func() {
+		update(func(u *User) error {
+			if u.Username == actingUser() {
+				return fmt.Errorf("you cannot disable your own account")
+			}
+			u.Disabled = !u.Disabled
+			return nil
+		}, "Account updated successfully!")
+		if selected != nil && selected.Disabled {
+			toggleButton.SetText("Enable Account")
+		} else {
+			toggleButton.SetText("Disable Account")
+		}
+	})
+
+	// Adding a user
+	usernameEntry := widget.NewEntry()
+	usernameEntry.SetPlaceHolder("Username")
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("Name")
+	roleSelect := widget.NewSelect(roleOptions(), nil)
+	roleSelect.PlaceHolder = "Select Role"
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Password")
+
+	addButton := widget.NewButton("Add User", func() {
+		if !requirePermission(window, permManageUsers) {
+			return
+		}
+		err := userDB.addUser(usernameEntry.Text, nameEntry.Text, roleFromLabel(roleSelect.Selected), passwordEntry.Text)
+		if err != nil {
+			statusLabel.SetText(err.Error())
+			return
+		}
+		usernameEntry.SetText("")
+		nameEntry.SetText("")
+		roleSelect.ClearSelected()
+		passwordEntry.SetText("")
+		refresh()
+		statusLabel.SetText("User added successfully!")
+	})
+
+	bottom := container.NewVBox(
+		widget.NewLabel("Selected User:"),
+		container.NewGridWithColumns(2, editRoleSelect, saveRoleButton),
+		container.NewGridWithColumns(2, resetPasswordEntry, resetPasswordButton),
+		toggleButton,
+		widget.NewLabel("Add User:"),
+		usernameEntry,
+		nameEntry,
+		roleSelect,
+		passwordEntry,
+		addButton,
+		statusLabel,
+	)
+
+	window.SetContent(container.NewPadded(container.NewBorder(nil, bottom, nil, nil, usersList)))
+	window.Resize(fyne.NewSize(450, 650))
+	window.Show()
+}
+
+// requirePermission shows an error and returns false if the current user
+// lacks a permission
+func requirePermission(window fyne.Window, p permission) bool {
+	if can(p) {
+		return true
+	}
+	dialog.ShowError(fmt.Errorf("your role does not allow this action"), window)
+	return false
+}
@@ -0,0 +1,265 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const webcamSupported = true
+
+// V4L2 constants from linux/videodev2.h
+const (
+	v4l2BufTypeVideoCapture = 1
+	v4l2MemoryMmap          = 1
+	v4l2CapVideoCapture     = 0x00000001
+	v4l2CapStreaming        = 0x04000000
+	v4l2CapDeviceCaps       = 0x80000000
+	v4l2PixFmtYUYV          = 'Y' | 'U'<<8 | 'Y'<<16 | 'V'<<24
+)
+
+// Webcam frame size requested; the driver picks the nearest it supports
+const (
+	webcamWidth  = 1280
+	webcamHeight = 720
+)
+
+const (
+	webcamBuffers = 4
+	// The first frames are dropped while the camera adjusts its exposure
+	webcamWarmupFrames = 10
+	webcamTimeout      = 5 * time.Second
+)
+
+type v4l2Capability struct {
+	driver       [16]byte
+	card         [32]byte
+	busInfo      [32]byte
+	version      uint32
+	capabilities uint32
+	deviceCaps   uint32
+	reserved     [3]uint32
+}
+
+type v4l2PixFormat struct {
+	width        uint32
+	height       uint32
+	pixelFormat  uint32
+	field        uint32
+	bytesPerLine uint32
+	sizeImage    uint32
+	colorspace   uint32
+	priv         uint32
+	flags        uint32
+	ycbcrEnc     uint32
+	quantization uint32
+	xferFunc     uint32
+}
+
+// v4l2Format holds a union of 200 bytes that is pointer aligned in C
+type v4l2Format struct {
+	typ uint32
+	fmt [200 / unsafe.Sizeof(uintptr(0))]uintptr
+}
+
+type v4l2RequestBuffers struct {
+	count        uint32
+	typ          uint32
+	memory       uint32
+	capabilities uint32
+	flags        uint8
+	reserved     [3]uint8
+}
+
+type v4l2Buffer struct {
+	index     uint32
+	typ       uint32
+	bytesUsed uint32
+	flags     uint32
+	field     uint32
+	timestamp syscall.Timeval
+	timecode  [16]byte
+	sequence  uint32
+	memory    uint32
+	offset    uintptr
+	length    uint32
+	reserved2 uint32
+	requestFD int32
+}
+
+// v4l2IOC builds an ioctl request number like the _IOC macro
+func v4l2IOC(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'V'<<8 | nr
+}
+
+const (
+	iocWrite = 1
+	iocRead  = 2
+)
+
+var (
+	vidiocQueryCap  = v4l2IOC(iocRead, 0, unsafe.Sizeof(v4l2Capability{}))
+	vidiocSetFormat = v4l2IOC(iocRead|iocWrite, 5, unsafe.Sizeof(v4l2Format{}))
+	vidiocReqBufs   = v4l2IOC(iocRead|iocWrite, 8, unsafe.Sizeof(v4l2RequestBuffers{}))
+	vidiocQueryBuf  = v4l2IOC(iocRead|iocWrite, 9, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocQBuf      = v4l2IOC(iocRead|iocWrite, 15, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocDQBuf     = v4l2IOC(iocRead|iocWrite, 17, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocStreamOn  = v4l2IOC(iocWrite, 18, unsafe.Sizeof(int32(0)))
+	vidiocStreamOff = v4l2IOC(iocWrite, 19, unsafe.Sizeof(int32(0)))
+)
+
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(arg))
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
+
+// webcamSource takes a still from a V4L2 webcam. Frames are read as YUYV,
+// which every UVC camera supports, and encoded as JPEG.
+type webcamSource struct {
+	device string
+}
+
+func (s webcamSource) name() string {
+	return "Webcam"
+}
+
+func (s webcamSource) capture() (capturedImage, error) {
+	fd, err := syscall.Open(s.device, syscall.O_RDWR|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return capturedImage{}, fmt.Errorf("cannot open webcam %s: %v", s.device, err)
+	}
+	defer syscall.Close(fd)
+
+	var caps v4l2Capability
+	if err := ioctl(fd, vidiocQueryCap, unsafe.Pointer(&caps)); err != nil {
+		return capturedImage{}, fmt.Errorf("%s is not a V4L2 device: %v", s.device, err)
+	}
+	deviceCaps := caps.capabilities
+	if deviceCaps&v4l2CapDeviceCaps != 0 {
+		deviceCaps = caps.deviceCaps
+	}
+	if deviceCaps&v4l2CapVideoCapture == 0 || deviceCaps&v4l2CapStreaming == 0 {
+		return capturedImage{}, fmt.Errorf("%s cannot capture video", s.device)
+	}
+
+	format := v4l2Format{typ: v4l2BufTypeVideoCapture}
+	pix := (*v4l2PixFormat)(unsafe.Pointer(&format.fmt[0]))
+	pix.width = webcamWidth
+	pix.height = webcamHeight
+	pix.pixelFormat = v4l2PixFmtYUYV
+	if err := ioctl(fd, vidiocSetFormat, unsafe.Pointer(&format)); err != nil {
+		return capturedImage{}, fmt.Errorf("cannot set webcam format: %v", err)
+	}
+	if pix.pixelFormat != v4l2PixFmtYUYV {
+		return capturedImage{}, fmt.Errorf("webcam %s does not support YUYV frames", s.device)
+	}
+
+	req := v4l2RequestBuffers{count: webcamBuffers, typ: v4l2BufTypeVideoCapture, memory: v4l2MemoryMmap}
+	if err := ioctl(fd, vidiocReqBufs, unsafe.Pointer(&req)); err != nil {
+		return capturedImage{}, fmt.Errorf("cannot allocate webcam buffers: %v", err)
+	}
+	if req.count == 0 {
+		return capturedImage{}, fmt.Errorf("webcam %s has no buffers", s.device)
+	}
+
+	buffers := make([][]byte, req.count)
+	defer func() {
+		for _, b := range buffers {
+			if b != nil {
+				syscall.Munmap(b)
+			}
+		}
+	}()
+	for i := range buffers {
+		buf := v4l2Buffer{index: uint32(i), typ: v4l2BufTypeVideoCapture, memory: v4l2MemoryMmap}
+		if err := ioctl(fd, vidiocQueryBuf, unsafe.Pointer(&buf)); err != nil {
+			return capturedImage{}, fmt.Errorf("cannot query webcam buffer: %v", err)
+		}
+		buffers[i], err = syscall.Mmap(fd, int64(uint32(buf.offset)), int(buf.length),
+			syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			return capturedImage{}, fmt.Errorf("cannot map webcam buffer: %v", err)
+		}
+		if err := ioctl(fd, vidiocQBuf, unsafe.Pointer(&buf)); err != nil {
+			return capturedImage{}, fmt.Errorf("cannot queue webcam buffer: %v", err)
+		}
+	}
+
+	bufType := int32(v4l2BufTypeVideoCapture)
+	if err := ioctl(fd, vidiocStreamOn, unsafe.Pointer(&bufType)); err != nil {
+		return capturedImage{}, fmt.Errorf("cannot start webcam: %v", err)
+	}
+	defer ioctl(fd, vidiocStreamOff, unsafe.Pointer(&bufType))
+
+	var frame []byte
+	deadline := time.Now().Add(webcamTimeout)
+	for n := 0; n <= webcamWarmupFrames; {
+		buf := v4l2Buffer{typ: v4l2BufTypeVideoCapture, memory: v4l2MemoryMmap}
+		err := ioctl(fd, vidiocDQBuf, unsafe.Pointer(&buf))
+		if err == syscall.EAGAIN {
+			if time.Now().After(deadline) {
+				return capturedImage{}, fmt.Errorf("webcam %s did not send a picture", s.device)
+			}
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return capturedImage{}, fmt.Errorf("cannot read from webcam: %v", err)
+		}
+		if n == webcamWarmupFrames {
+			frame = append([]byte{}, buffers[buf.index][:buf.bytesUsed]...)
+		}
+		if err := ioctl(fd, vidiocQBuf, unsafe.Pointer(&buf)); err != nil {
+			return capturedImage{}, fmt.Errorf("cannot queue webcam buffer: %v", err)
+		}
+		n++
+	}
+
+	data, err := encodeYUYV(frame, int(pix.width), int(pix.height), int(pix.bytesPerLine))
+	if err != nil {
+		return capturedImage{}, err
+	}
+	return capturedImage{data: data}, nil
+}
+
+// encodeYUYV converts a packed YUYV 4:2:2 frame to JPEG
+func encodeYUYV(frame []byte, width, height, stride int) ([]byte, error) {
+	if stride < width*2 {
+		stride = width * 2
+	}
+	if len(frame) < stride*height {
+		return nil, fmt.Errorf("webcam sent an incomplete picture")
+	}
+
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio422)
+	for y := 0; y < height; y++ {
+		row := frame[y*stride:]
+		for x := 0; x+1 < width; x += 2 {
+			i := x * 2
+			img.Y[y*img.YStride+x] = row[i]
+			img.Y[y*img.YStride+x+1] = row[i+2]
+			img.Cb[y*img.CStride+x/2] = row[i+1]
+			img.Cr[y*img.CStride+x/2] = row[i+3]
+		}
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
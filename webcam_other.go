@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// Webcam capture uses V4L2, which only exists on Linux
+const webcamSupported = false
+
+type webcamSource struct {
+	device string
+}
+
+func (s webcamSource) name() string {
+	return "Webcam"
+}
+
+func (s webcamSource) capture() (capturedImage, error) {
+	return capturedImage{}, fmt.Errorf("webcam capture is only supported on Linux")
+}